@@ -0,0 +1,128 @@
+package gotcc
+
+import "sort"
+
+// Max number of cycles reported by ErrLoopDependency.
+const maxReportedCycles = 100
+
+// Find the distinct elementary cycles of the dependency graph with Johnson's algorithm.
+// Each cycle is a list of task names, where every task depends on the next one, and the
+// last one depends on the first one.
+func (m *TCController) findCycles() [][]string {
+	// sort tasks by name, so that the result is stable
+	ids := make([]uint32, 0, len(m.executors))
+	for taskid := range m.executors {
+		ids = append(ids, taskid)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if m.executors[ids[i]].name == m.executors[ids[j]].name {
+			return ids[i] < ids[j]
+		}
+		return m.executors[ids[i]].name < m.executors[ids[j]].name
+	})
+	index := make(map[uint32]int, len(ids))
+	for i, taskid := range ids {
+		index[taskid] = i
+	}
+	adjacency := make([][]int, len(ids))
+	reverse := make([][]int, len(ids))
+	for i, taskid := range ids {
+		for depid := range m.executors[taskid].dependency {
+			if j, exists := index[depid]; exists {
+				adjacency[i] = append(adjacency[i], j)
+				reverse[j] = append(reverse[j], i)
+			}
+		}
+		sort.Ints(adjacency[i])
+	}
+
+	cycles := [][]string{}
+	for start := range ids {
+		if len(cycles) >= maxReportedCycles {
+			break
+		}
+		// only search the cycles whose smallest task is `start`
+		component := stronglyConnected(adjacency, reverse, start)
+		blocked := map[int]bool{}
+		blockedBy := map[int]map[int]bool{}
+		stack := []int{}
+
+		var unblock func(v int)
+		unblock = func(v int) {
+			blocked[v] = false
+			for w := range blockedBy[v] {
+				delete(blockedBy[v], w)
+				if blocked[w] {
+					unblock(w)
+				}
+			}
+		}
+		var circuit func(v int) bool
+		circuit = func(v int) bool {
+			found := false
+			stack = append(stack, v)
+			blocked[v] = true
+			for _, w := range adjacency[v] {
+				if !component[w] || len(cycles) >= maxReportedCycles {
+					continue
+				}
+				if w == start {
+					cycle := make([]string, 0, len(stack))
+					for _, u := range stack {
+						cycle = append(cycle, m.executors[ids[u]].name)
+					}
+					cycles = append(cycles, cycle)
+					found = true
+				} else if !blocked[w] && circuit(w) {
+					found = true
+				}
+			}
+			if found {
+				unblock(v)
+			} else {
+				for _, w := range adjacency[v] {
+					if component[w] {
+						if blockedBy[w] == nil {
+							blockedBy[w] = map[int]bool{}
+						}
+						blockedBy[w][v] = true
+					}
+				}
+			}
+			stack = stack[:len(stack)-1]
+			return found
+		}
+		if component[start] {
+			circuit(start)
+		}
+	}
+	return cycles
+}
+
+// Get the strongly connected component containing `start`, in the subgraph of the
+// vertices not smaller than `start`. It is empty if `start` is not in any cycle.
+func stronglyConnected(adjacency [][]int, reverse [][]int, start int) map[int]bool {
+	reach := func(edges [][]int) map[int]bool {
+		visited := map[int]bool{}
+		queue := []int{start}
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			for _, u := range edges[v] {
+				if u >= start && !visited[u] {
+					visited[u] = true
+					queue = append(queue, u)
+				}
+			}
+		}
+		return visited
+	}
+	forward, backward := reach(adjacency), reach(reverse)
+	component := map[int]bool{}
+	for v := range forward {
+		if backward[v] {
+			component[v] = true
+		}
+	}
+	return component
+}
@@ -1,59 +1,356 @@
 package gotcc
 
 import (
+	"fmt"
+	"runtime/debug"
 	"sort"
+	"strings"
+)
+
+// Outcome of a task in a run.
+type taskOutcome int
+
+const (
+	outcomePending taskOutcome = iota
+	outcomeSucceeded
+	outcomeFailed
+	// never launched because its dependency expression became false
+	outcomeSkipped
+)
+
+// Value of a dependency expression in three-valued (Kleene) logic. It is unknown
+// while the tasks it depends on are still pending.
+type exprValue int
+
+const (
+	valueUnknown exprValue = iota
+	valueFalse
+	valueTrue
+)
+
+func boolValue(b bool) exprValue {
+	if b {
+		return valueTrue
+	}
+	return valueFalse
+}
+
+func (v exprValue) not() exprValue {
+	switch v {
+	case valueTrue:
+		return valueFalse
+	case valueFalse:
+		return valueTrue
+	}
+	return valueUnknown
+}
+
+// Kind of a node of a dependency expression.
+type ExprKind int
+
+const (
+	ExprTrue ExprKind = iota
+	ExprFalse
+	ExprLeaf
+	ExprNot
+	ExprAnd
+	ExprOr
+	ExprXor
+	ExprAtLeast
+)
+
+// Condition of a leaf on its task.
+type LeafCondition int
+
+const (
+	// true when the task succeeded
+	LeafSucceeded LeafCondition = iota
+	// true when the task failed
+	LeafFailed
+	// true when the task finished, no matter it succeeded, failed or was skipped
+	LeafFinished
+	// true when the task succeeded and its result satisfies the predicate
+	LeafValue
 )
 
 // A dependency expression is a filter to describe the tasks' dependency
-// A task will be launched only if the expression is true.
+// A task will be launched only if the expression is definitely true, and skipped
+// once it is definitely false. A leaf is unknown while its task is pending.
+// It is a tree of And/Or/Not/Xor/AtLeast nodes, whose leaves are conditions on tasks.
 type DependencyExpression struct {
-	f      func() bool
-	allAnd bool
+	kind      ExprKind
+	operands  []DependencyExpression
+	threshold int
+
+	// only for leaves
+	task      *Executor
+	condition LeafCondition
+	predicate func(value interface{}) bool
 }
 
 func MakeNotExpr(Expr DependencyExpression) DependencyExpression {
-	return DependencyExpression{
-		f: func() bool {
-			return !Expr.f()
-		},
-		allAnd: false,
-	}
+	return DependencyExpression{kind: ExprNot, operands: []DependencyExpression{Expr}}
 }
 
 func MakeAndExpr(Expr1 DependencyExpression, Expr2 DependencyExpression) DependencyExpression {
-	return DependencyExpression{
-		f: func() bool {
-			return Expr1.f() && Expr2.f()
-		},
-		allAnd: Expr1.allAnd && Expr2.allAnd,
-	}
+	return DependencyExpression{kind: ExprAnd, operands: []DependencyExpression{Expr1, Expr2}}
 }
 
 func MakeOrExpr(Expr1 DependencyExpression, Expr2 DependencyExpression) DependencyExpression {
-	return DependencyExpression{
-		f: func() bool {
-			return Expr1.f() || Expr2.f()
-		},
-		allAnd: false,
-	}
+	return DependencyExpression{kind: ExprOr, operands: []DependencyExpression{Expr1, Expr2}}
 }
 
 func MakeXorExpr(Expr1 DependencyExpression, Expr2 DependencyExpression) DependencyExpression {
-	return DependencyExpression{
-		f: func() bool {
-			return (Expr1.f() && !Expr2.f()) || (!Expr1.f() && Expr2.f())
-		},
-		allAnd: false,
+	return DependencyExpression{kind: ExprXor, operands: []DependencyExpression{Expr1, Expr2}}
+}
+
+// It is true when all of `Exprs` are true. True if `Exprs` is empty.
+func MakeAllOfExpr(Exprs ...DependencyExpression) DependencyExpression {
+	return DependencyExpression{kind: ExprAnd, operands: append([]DependencyExpression{}, Exprs...)}
+}
+
+// It is true when any of `Exprs` is true. False if `Exprs` is empty.
+func MakeAnyOfExpr(Exprs ...DependencyExpression) DependencyExpression {
+	return DependencyExpression{kind: ExprOr, operands: append([]DependencyExpression{}, Exprs...)}
+}
+
+// It is true when at least `k` of `Exprs` are true, for example, a quorum of replicas.
+func MakeAtLeastExpr(k int, Exprs ...DependencyExpression) DependencyExpression {
+	if k > len(Exprs) {
+		return DefaultFalseExpr
+	}
+	if k == len(Exprs) {
+		// the same as AND
+		return MakeAllOfExpr(Exprs...)
+	}
+	return DependencyExpression{kind: ExprAtLeast, operands: append([]DependencyExpression{}, Exprs...), threshold: k}
+}
+
+func newLeafExpr(d *Executor, condition LeafCondition) DependencyExpression {
+	return DependencyExpression{kind: ExprLeaf, task: d, condition: condition}
+}
+
+// Create a value dependency expression for executor `e`. It is true when executor `d`
+// succeeded and its result satisfies `predicate`, for example, a risk score above 0.8.
+// `predicate` is called by the controller, so it should be fast and never block. If it
+// panics, the execution is aborted with ErrPredicatePanic.
+func MakeValueExpr(e *Executor, d *Executor, predicate func(value interface{}) bool) DependencyExpression {
+	e.subscribe(d)
+	Expr := newLeafExpr(d, LeafValue)
+	Expr.predicate = predicate
+	return Expr
+}
+
+// Get the kind of the root node of the expression.
+func (Expr DependencyExpression) Kind() ExprKind {
+	return Expr.kind
+}
+
+// Get the operands of a Not/And/Or/Xor/AtLeast expression.
+func (Expr DependencyExpression) Operands() []DependencyExpression {
+	return append([]DependencyExpression{}, Expr.operands...)
+}
+
+// Get `k` of an AtLeast expression.
+func (Expr DependencyExpression) Threshold() int {
+	return Expr.threshold
+}
+
+// Get the task of a leaf expression, and the condition on it.
+func (Expr DependencyExpression) Leaf() (*Executor, LeafCondition) {
+	return Expr.task, Expr.condition
+}
+
+// Visit the nodes of the expression in depth-first pre-order.
+// The operands of a node are skipped if `visit` returns false.
+func (Expr DependencyExpression) Walk(visit func(Expr DependencyExpression) bool) {
+	if !visit(Expr) {
+		return
 	}
+	for _, operand := range Expr.operands {
+		operand.Walk(visit)
+	}
+}
+
+// Get the distinct executors referenced by the expression, in the order of appearance.
+func (Expr DependencyExpression) Executors() []*Executor {
+	res := []*Executor{}
+	seen := map[uint32]bool{}
+	Expr.Walk(func(node DependencyExpression) bool {
+		if node.kind == ExprLeaf && !seen[node.task.id] {
+			seen[node.task.id] = true
+			res = append(res, node.task)
+		}
+		return true
+	})
+	return res
+}
+
+// Render the expression, such as "(hello && world) || !foo".
+func (Expr DependencyExpression) String() string {
+	var sb strings.Builder
+	Expr.render(&sb, false)
+	return sb.String()
+}
+
+func (Expr DependencyExpression) render(sb *strings.Builder, nested bool) {
+	switch Expr.kind {
+	case ExprTrue:
+		sb.WriteString("true")
+	case ExprFalse:
+		sb.WriteString("false")
+	case ExprLeaf:
+		switch Expr.condition {
+		case LeafSucceeded:
+			sb.WriteString(quoteName(Expr.task.name))
+		case LeafFailed:
+			sb.WriteString("failed(" + quoteName(Expr.task.name) + ")")
+		case LeafFinished:
+			sb.WriteString("finished(" + quoteName(Expr.task.name) + ")")
+		case LeafValue:
+			sb.WriteString("value(" + quoteName(Expr.task.name) + ")")
+		}
+	case ExprNot:
+		sb.WriteString("!")
+		Expr.operands[0].render(sb, true)
+	case ExprAtLeast:
+		sb.WriteString(fmt.Sprintf("atleast(%d", Expr.threshold))
+		for _, operand := range Expr.operands {
+			sb.WriteString(", ")
+			operand.render(sb, false)
+		}
+		sb.WriteString(")")
+	case ExprAnd, ExprOr, ExprXor:
+		operands := Expr.flatten()
+		if len(operands) == 0 {
+			// empty AllOf is true, and empty AnyOf is false
+			if Expr.kind == ExprAnd {
+				sb.WriteString("true")
+			} else {
+				sb.WriteString("false")
+			}
+			return
+		}
+		if len(operands) == 1 {
+			operands[0].render(sb, nested)
+			return
+		}
+		if nested {
+			sb.WriteString("(")
+		}
+		operator := map[ExprKind]string{ExprAnd: " && ", ExprOr: " || ", ExprXor: " ^ "}[Expr.kind]
+		for i, operand := range operands {
+			if i > 0 {
+				sb.WriteString(operator)
+			}
+			operand.render(sb, true)
+		}
+		if nested {
+			sb.WriteString(")")
+		}
+	}
+}
+
+// Flatten nested And (or Or) operands, because `(a && b) && c` is the same as `a && b && c`.
+func (Expr DependencyExpression) flatten() []DependencyExpression {
+	if Expr.kind == ExprXor {
+		return Expr.operands
+	}
+	res := make([]DependencyExpression, 0, len(Expr.operands))
+	for _, operand := range Expr.operands {
+		if operand.kind == Expr.kind {
+			res = append(res, operand.flatten()...)
+		} else {
+			res = append(res, operand)
+		}
+	}
+	return res
+}
+
+// Call the predicate of a value leaf. If it panics, panic again with ErrPredicatePanic,
+// which the scheduler recovers.
+func (Expr DependencyExpression) holds(value interface{}) bool {
+	defer func() {
+		if r := recover(); r != nil {
+			panic(ErrPredicatePanic{TaskName: Expr.task.name, Value: r, Stack: debug.Stack()})
+		}
+	}()
+	return Expr.predicate(value)
 }
 
-func newDependencyExpr(valMap map[uint32]bool, key uint32) DependencyExpression {
-	return DependencyExpression{
-		f: func() bool {
-			return valMap[key]
-		},
-		allAnd: true,
+// Evaluate the expression with Kleene logic. `outcomes` records which tasks have
+// succeeded, failed or been skipped. Other tasks are pending. `values` records the
+// results of succeeded tasks.
+func (Expr DependencyExpression) eval(outcomes map[uint32]taskOutcome, values map[uint32]interface{}) exprValue {
+	switch Expr.kind {
+	case ExprTrue:
+		return valueTrue
+	case ExprFalse:
+		return valueFalse
+	case ExprLeaf:
+		outcome := outcomes[Expr.task.id]
+		if outcome == outcomePending {
+			return valueUnknown
+		}
+		switch Expr.condition {
+		case LeafSucceeded:
+			return boolValue(outcome == outcomeSucceeded)
+		case LeafFailed:
+			return boolValue(outcome == outcomeFailed)
+		case LeafFinished:
+			return valueTrue
+		case LeafValue:
+			return boolValue(outcome == outcomeSucceeded && Expr.holds(values[Expr.task.id]))
+		}
+	case ExprNot:
+		return Expr.operands[0].eval(outcomes, values).not()
+	case ExprAnd:
+		res := valueTrue
+		for _, operand := range Expr.operands {
+			switch operand.eval(outcomes, values) {
+			case valueFalse:
+				return valueFalse
+			case valueUnknown:
+				res = valueUnknown
+			}
+		}
+		return res
+	case ExprOr:
+		res := valueFalse
+		for _, operand := range Expr.operands {
+			switch operand.eval(outcomes, values) {
+			case valueTrue:
+				return valueTrue
+			case valueUnknown:
+				res = valueUnknown
+			}
+		}
+		return res
+	case ExprXor:
+		v1, v2 := Expr.operands[0].eval(outcomes, values), Expr.operands[1].eval(outcomes, values)
+		if v1 == valueUnknown || v2 == valueUnknown {
+			return valueUnknown
+		}
+		return boolValue(v1 != v2)
+	case ExprAtLeast:
+		countTrue, countFalse := 0, 0
+		for _, operand := range Expr.operands {
+			switch operand.eval(outcomes, values) {
+			case valueTrue:
+				countTrue++
+			case valueFalse:
+				countFalse++
+			}
+		}
+		if countTrue >= Expr.threshold {
+			return valueTrue
+		}
+		if countFalse > len(Expr.operands)-Expr.threshold {
+			return valueFalse
+		}
+		return valueUnknown
 	}
+	return valueFalse
 }
 
 func (m *TCController) analyzeDependency() (map[uint32]int, bool) {
@@ -108,7 +405,7 @@ func max(x, y int) int {
 	return y
 }
 
-func (m *TCController) sortExecutor(taskorder map[uint32]int) ([]uint32, bool) {
+func (m *TCController) sortExecutor(taskorder map[uint32]int) []uint32 {
 	type item struct {
 		taskid   uint32
 		taskname string
@@ -118,9 +415,6 @@ func (m *TCController) sortExecutor(taskorder map[uint32]int) ([]uint32, bool) {
 	res := make([]uint32, 0, len(taskorder))
 	for taskid, order := range taskorder {
 		e := m.executors[taskid]
-		if !e.dependencyExpr.allAnd {
-			return nil, false
-		}
 		itemlist = append(itemlist, item{
 			taskid:   taskid,
 			taskname: e.name,
@@ -136,21 +430,11 @@ func (m *TCController) sortExecutor(taskorder map[uint32]int) ([]uint32, bool) {
 	for i := range itemlist {
 		res = append(res, itemlist[i].taskid)
 	}
-	return res, true
+	return res
 }
 
 // default dependency expression: always return true
-var DefaultTrueExpr = DependencyExpression{
-	f: func() bool {
-		return true
-	},
-	allAnd: true,
-}
+var DefaultTrueExpr = DependencyExpression{kind: ExprTrue}
 
 // default dependency expression: always return false
-var DefaultFalseExpr = DependencyExpression{
-	f: func() bool {
-		return false
-	},
-	allAnd: true,
-}
+var DefaultFalseExpr = DependencyExpression{kind: ExprFalse}
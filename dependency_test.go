@@ -1,6 +1,9 @@
 package gotcc
 
-import "testing"
+import (
+	"strconv"
+	"testing"
+)
 
 func TestDependency(t *testing.T) {
 	A := newExecutor("A", nil, "A")
@@ -28,61 +31,365 @@ func TestDependency(t *testing.T) {
 	// 1 0   0  1  0  1
 	// 0 1   0  1  0  0
 	// 1 1   1  1  0  0
+	// a task succeeded if its dependency expression is true, and failed otherwise
+	outcomeOf := func(succeeded bool) taskOutcome {
+		if succeeded {
+			return outcomeSucceeded
+		}
+		return outcomeFailed
+	}
 	checkResult := func(valA bool, valB bool, valC bool, valD bool, valE bool, valF bool) bool {
-		if valA {
-			A.SetDependency(DefaultTrueExpr)
-		} else {
-			A.SetDependency(DefaultFalseExpr)
+		outcomes := map[uint32]taskOutcome{A.id: outcomeOf(valA), B.id: outcomeOf(valB)}
+		calc := func(e *Executor) bool {
+			val := e.dependencyExpr.eval(outcomes, nil) == valueTrue
+			outcomes[e.id] = outcomeOf(val)
+			return val
+		}
+		return calc(C) == valC && calc(D) == valD && calc(E) == valE && calc(F) == valF
+	}
+
+	// 0 0   0  0  1  0
+	if !checkResult(false, false, false, false, true, false) {
+		t.Errorf("Error: A=false, B=false\n")
+	}
+
+	// 1 0   0  1  0  1
+	if !checkResult(true, false, false, true, false, true) {
+		t.Errorf("Error: A=true, B=false\n")
+	}
+
+	// 0 1   0  1  0  0
+	if !checkResult(false, true, false, true, false, false) {
+		t.Errorf("Error: A=false, B=true\n")
+	}
+
+	// 1 1   1  1  0  0
+	if !checkResult(true, true, true, true, false, false) {
+		t.Errorf("Error: A=true, B=true\n")
+	}
+}
+
+func TestFailureDependency(t *testing.T) {
+	for _, fetchFailed := range []bool{true, false} {
+		controller := NewTCController()
+		fetchTask := TaskDefault
+		if fetchFailed {
+			fetchTask = TaskSilentFail
+		}
+		fetch := controller.AddTask("fetch", fetchTask, 1)
+		cache := controller.AddTask("cache", TaskDefault, 2)
+		cleanup := controller.AddTask("cleanup", TaskDefault, 3)
+		merge := controller.AddTask("merge", TaskDefault, 4)
+
+		// use the cache if fetch failed
+		cache.SetDependency(cache.NewFailureDependencyExpr(fetch))
+		// clean up after fetch no matter it succeeded or failed
+		cleanup.SetDependency(cleanup.NewFinishedDependencyExpr(fetch))
+		merge.SetDependency(MakeOrExpr(merge.NewDependencyExpr(fetch), merge.NewDependencyExpr(cache)))
+
+		controller.SetTermination(MakeAndExpr(controller.NewTerminationExpr(merge), controller.NewTerminationExpr(cleanup)))
+
+		h := controller.Start()
+		res, err := h.Wait()
+		if err != nil {
+			t.Fatal(err)
 		}
-		if valB {
-			B.SetDependency(DefaultTrueExpr)
+		if fetchFailed {
+			// 4 + 2
+			if res["merge"] != 6 || res["cleanup"] != 3 {
+				t.Fatal("Result Error", res)
+			}
 		} else {
-			B.SetDependency(DefaultFalseExpr)
+			// 4 + 1
+			if res["merge"] != 5 || res["cleanup"] != 4 {
+				t.Fatal("Result Error", res)
+			}
+			// failed(fetch) is definitely false
+			if status := h.Report().Task("cache").Status; status != TaskSkipped {
+				t.Fatal("Status Error", status)
+			}
+		}
+	}
+}
+
+func TestKleeneDependency(t *testing.T) {
+	A, B := newExecutor("A", nil, nil), newExecutor("B", nil, nil)
+	Expr := MakeOrExpr(A.NewDependencyExpr(A), MakeNotExpr(A.NewDependencyExpr(B)))
+	expected := []struct {
+		a, b taskOutcome
+		val  exprValue
+	}{
+		{outcomePending, outcomePending, valueUnknown},
+		{outcomeSucceeded, outcomePending, valueTrue},
+		{outcomeFailed, outcomePending, valueUnknown},
+		{outcomeFailed, outcomeSucceeded, valueFalse},
+		{outcomeFailed, outcomeFailed, valueTrue},
+		{outcomeSkipped, outcomeSkipped, valueTrue},
+	}
+	for _, c := range expected {
+		if v := Expr.eval(map[uint32]taskOutcome{A.id: c.a, B.id: c.b}, nil); v != c.val {
+			t.Fatal("Expression Error", c, v)
+		}
+	}
+
+	for _, primaryFailed := range []bool{true, false} {
+		controller := NewTCController()
+		primaryTask := TaskHang
+		if primaryFailed {
+			primaryTask = func(args map[string]interface{}) (interface{}, error) {
+				TaskHang(args)
+				return nil, ErrSilentFail{}
+			}
+		}
+		primary := controller.AddTask("primary", primaryTask, 20)
+		secondary := controller.AddTask("secondary", TaskDefault, 2)
+		last := controller.AddTask("last", TaskDefault, 3)
+
+		// run secondary unless primary succeeds, but not before primary finished
+		secondary.SetDependency(MakeNotExpr(secondary.NewDependencyExpr(primary)))
+		last.SetDependency(MakeOrExpr(last.NewDependencyExpr(secondary), last.NewFinishedDependencyExpr(primary)))
+		controller.SetTermination(controller.NewTerminationExpr(last))
+
+		h := controller.Start()
+		if _, err := h.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		report := h.Report()
+		if primaryFailed {
+			if report.Task("secondary").Status != TaskSucceeded || report.Task("secondary").StartTime.Before(report.Task("primary").EndTime) {
+				t.Fatal("Secondary Error", report)
+			}
+		} else if report.Task("secondary").Status != TaskSkipped {
+			t.Fatal("Secondary Error", report)
 		}
+	}
+}
+
+func TestVariadicDependency(t *testing.T) {
+	controller := NewTCController()
+	replicas := make([]*Executor, 0, 5)
+	for i := 0; i < 5; i++ {
+		replicas = append(replicas, controller.AddTask(strconv.Itoa(i), TaskDefault, i))
+	}
+	allTask := controller.AddTask("all", TaskDefault, 0)
+	anyTask := controller.AddTask("any", TaskDefault, 0)
+	quorumTask := controller.AddTask("quorum", TaskDefault, 0)
+
+	allExprs, anyExprs, quorumExprs := []DependencyExpression{}, []DependencyExpression{}, []DependencyExpression{}
+	for _, replica := range replicas {
+		allExprs = append(allExprs, allTask.NewDependencyExpr(replica))
+		anyExprs = append(anyExprs, anyTask.NewDependencyExpr(replica))
+		quorumExprs = append(quorumExprs, quorumTask.NewDependencyExpr(replica))
+	}
+	allTask.SetDependency(MakeAllOfExpr(allExprs...))
+	anyTask.SetDependency(MakeAnyOfExpr(anyExprs...))
+	quorumTask.SetDependency(MakeAtLeastExpr(3, quorumExprs...))
 
-		C.markDependency(A.id, A.calcDependency())
-		C.markDependency(B.id, B.calcDependency())
+	// replica 0 and 1 are done
+	state := map[uint32]taskOutcome{replicas[0].id: outcomeSucceeded, replicas[1].id: outcomeSucceeded}
+	if allTask.dependencyExpr.eval(state, nil) != valueUnknown || anyTask.dependencyExpr.eval(state, nil) != valueTrue || quorumTask.dependencyExpr.eval(state, nil) != valueUnknown {
+		t.Fatal("Expression Error")
+	}
+	// replica 0, 1 and 4 are done
+	state[replicas[4].id] = outcomeSucceeded
+	if allTask.dependencyExpr.eval(state, nil) != valueUnknown || anyTask.dependencyExpr.eval(state, nil) != valueTrue || quorumTask.dependencyExpr.eval(state, nil) != valueTrue {
+		t.Fatal("Expression Error")
+	}
 
-		D.markDependency(A.id, A.calcDependency())
-		D.markDependency(B.id, B.calcDependency())
+	if MakeAllOfExpr().eval(state, nil) != valueTrue || MakeAnyOfExpr().eval(state, nil) != valueFalse || MakeAtLeastExpr(6, quorumExprs...).eval(state, nil) != valueFalse {
+		t.Fatal("Expression Error")
+	}
 
-		E.markDependency(D.id, D.calcDependency())
+	controller.SetTermination(MakeAllOfExpr(controller.NewTerminationExpr(allTask), controller.NewTerminationExpr(anyTask), controller.NewTerminationExpr(quorumTask)))
+	pool := NewDefaultPool(2)
+	defer pool.Close()
+	res, err := controller.PoolRun(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["all"] != 10 || res["quorum"] == nil {
+		t.Fatal("Result Error", res)
+	}
+}
+
+func TestDependencyString(t *testing.T) {
+	hello := newExecutor("hello", nil, nil)
+	world := newExecutor("world", nil, nil)
+	foo := newExecutor("foo", nil, nil)
+	bar := newExecutor("bar", nil, nil)
 
-		F.markDependency(B.id, B.calcDependency())
-		F.markDependency(D.id, D.calcDependency())
+	bar.SetDependency(MakeOrExpr(MakeAndExpr(bar.NewDependencyExpr(hello), bar.NewDependencyExpr(world)), MakeNotExpr(bar.NewDependencyExpr(foo))))
+	if s := bar.DependencyExpr().String(); s != "(hello && world) || !foo" {
+		t.Fatal("String Error", s)
+	}
 
-		if valC != C.calcDependency() {
-			return false
+	expected := map[string]DependencyExpression{
+		"hello && world && foo":                 MakeAndExpr(MakeAndExpr(bar.NewDependencyExpr(hello), bar.NewDependencyExpr(world)), bar.NewDependencyExpr(foo)),
+		"hello ^ !(world || foo)":               MakeXorExpr(bar.NewDependencyExpr(hello), MakeNotExpr(MakeAnyOfExpr(bar.NewDependencyExpr(world), bar.NewDependencyExpr(foo)))),
+		"atleast(2, hello, failed(world), foo)": MakeAtLeastExpr(2, bar.NewDependencyExpr(hello), bar.NewFailureDependencyExpr(world), bar.NewDependencyExpr(foo)),
+		"finished(hello) && false":              MakeAllOfExpr(bar.NewFinishedDependencyExpr(hello), DefaultFalseExpr),
+		"true":                                  MakeAllOfExpr(),
+		"false":                                 MakeAnyOfExpr(),
+	}
+	for s, Expr := range expected {
+		if Expr.String() != s {
+			t.Fatal("String Error", Expr.String(), s)
 		}
-		if valD != D.calcDependency() {
-			return false
+	}
+
+	kinds := []ExprKind{}
+	bar.DependencyExpr().Walk(func(Expr DependencyExpression) bool {
+		kinds = append(kinds, Expr.Kind())
+		return Expr.Kind() != ExprNot
+	})
+	if len(kinds) != 5 || kinds[0] != ExprOr || kinds[1] != ExprAnd || kinds[2] != ExprLeaf || kinds[4] != ExprNot {
+		t.Fatal("Walk Error", kinds)
+	}
+
+	executors := MakeAndExpr(bar.DependencyExpr(), bar.NewDependencyExpr(hello)).Executors()
+	if len(executors) != 3 || executors[0] != hello || executors[1] != world || executors[2] != foo {
+		t.Fatal("Executors Error", executors)
+	}
+	if task, condition := bar.NewFailureDependencyExpr(world).Leaf(); task != world || condition != LeafFailed {
+		t.Fatal("Leaf Error")
+	}
+}
+
+func TestUnsatisfiable(t *testing.T) {
+	controller := NewTCController()
+	A := controller.AddTask("A", TaskDefault, 1)
+	B := controller.AddTask("B", TaskDefault, 2)
+	C := controller.AddTask("C", TaskDefault, 3)
+	D := controller.AddTask("D", TaskDefault, 4)
+
+	unsatisfiable := map[string]DependencyExpression{
+		"A && !A":                       MakeAndExpr(C.NewDependencyExpr(A), MakeNotExpr(C.NewDependencyExpr(A))),
+		"A ^ A":                         MakeXorExpr(C.NewDependencyExpr(A), C.NewDependencyExpr(A)),
+		"failed(A) && finished(A) && A": MakeAllOfExpr(C.NewFailureDependencyExpr(A), C.NewFinishedDependencyExpr(A), C.NewDependencyExpr(A)),
+		"atleast(2, A && B, false, !finished(A))": MakeAtLeastExpr(2, MakeAndExpr(C.NewDependencyExpr(A), C.NewDependencyExpr(B)), DefaultFalseExpr, MakeNotExpr(C.NewFinishedDependencyExpr(A))),
+	}
+	controller.SetTermination(MakeAndExpr(controller.NewTerminationExpr(C), controller.NewTerminationExpr(D)))
+	for s, Expr := range unsatisfiable {
+		C.SetDependency(MakeAndExpr(C.NewDependencyExpr(B), Expr))
+		_, err := controller.Compile()
+		unsat, ok := err.(ErrUnsatisfiable)
+		if !ok {
+			t.Fatal(s, err)
 		}
-		if valE != E.calcDependency() {
-			return false
+		if unsat.TaskName != "C" || unsat.Termination || unsat.SubExpr.String() != s {
+			t.Fatal("Unsatisfiable Error", s, err)
 		}
-		if valF != F.calcDependency() {
-			return false
+	}
+
+	satisfiable := []DependencyExpression{
+		MakeOrExpr(C.NewDependencyExpr(A), MakeNotExpr(C.NewDependencyExpr(A))),
+		MakeXorExpr(C.NewDependencyExpr(A), C.NewFailureDependencyExpr(A)),
+		MakeAndExpr(C.NewDependencyExpr(A), MakeNotExpr(C.NewFailureDependencyExpr(A))),
+		MakeAtLeastExpr(2, C.NewDependencyExpr(A), C.NewFailureDependencyExpr(A), C.NewDependencyExpr(B)),
+	}
+	for _, Expr := range satisfiable {
+		C.SetDependency(Expr)
+		if _, err := controller.Compile(); err != nil {
+			t.Fatal(Expr, err)
 		}
-		return true
 	}
 
-	// 0 0   0  0  1  0
-	if !checkResult(false, false, false, false, true, false) {
-		t.Errorf("Error: A=%v, B=%v, C=%v, D=%v, E=%v, F=%v\n", A.calcDependency(), B.calcDependency(), C.calcDependency(), D.calcDependency(), E.calcDependency(), F.calcDependency())
+	// D can never be launched
+	C.SetDependency(C.NewDependencyExpr(A))
+	D.SetDependency(MakeAndExpr(D.NewDependencyExpr(B), DefaultFalseExpr))
+	_, err := controller.Compile()
+	if unsat, ok := err.(ErrUnsatisfiable); !ok || unsat.TaskName != "D" || unsat.SubExpr.String() != "false" {
+		t.Fatal(err)
 	}
+	D.SetDependency(MakeOrExpr(D.NewDependencyExpr(B), DefaultFalseExpr))
+	// C can not both succeed and fail
+	controller.SetTermination(MakeAllOfExpr(controller.NewTerminationExpr(C), controller.termination.NewFailureDependencyExpr(C), controller.NewTerminationExpr(D)))
+	_, err = controller.Compile()
+	if unsat, ok := err.(ErrUnsatisfiable); !ok || !unsat.Termination {
+		t.Fatal(err)
+	}
+	t.Log(err)
 
-	// 1 0   0  1  0  1
-	if !checkResult(true, false, false, true, false, true) {
-		t.Errorf("Error: A=%v, B=%v, C=%v, D=%v, E=%v, F=%v\n", A.calcDependency(), B.calcDependency(), C.calcDependency(), D.calcDependency(), E.calcDependency(), F.calcDependency())
+	// D is launched only if C succeeded, and C only if A succeeded
+	D.SetDependency(D.NewDependencyExpr(C))
+	for s, Expr := range map[string]DependencyExpression{
+		"C && !A":         MakeAndExpr(controller.NewTerminationExpr(C), MakeNotExpr(controller.NewTerminationExpr(A))),
+		"D && failed(A)":  MakeAndExpr(controller.NewTerminationExpr(D), controller.termination.NewFailureDependencyExpr(A)),
+		"failed(D) && !C": MakeAndExpr(controller.termination.NewFailureDependencyExpr(D), MakeNotExpr(controller.NewTerminationExpr(C))),
+	} {
+		controller.SetTermination(Expr)
+		_, err = controller.Compile()
+		if unsat, ok := err.(ErrUnsatisfiable); !ok || !unsat.Termination || unsat.SubExpr.String() != s {
+			t.Fatal(s, err)
+		}
+	}
+	// D always finishes or is skipped, but it may be skipped while A succeeded
+	controller.SetTermination(MakeAndExpr(controller.NewTerminationExpr(A), MakeNotExpr(controller.termination.NewFinishedDependencyExpr(D))))
+	if _, err = controller.Compile(); err == nil {
+		t.Fatal("Compile not fail!")
+	}
+	controller.SetTermination(MakeAndExpr(controller.NewTerminationExpr(A), MakeNotExpr(controller.NewTerminationExpr(D))))
+	if _, err = controller.Compile(); err != nil {
+		t.Fatal(err)
 	}
+}
 
-	// 0 1   0  1  0  0
-	if !checkResult(false, true, false, true, false, false) {
-		t.Errorf("Error: A=%v, B=%v, C=%v, D=%v, E=%v, F=%v\n", A.calcDependency(), B.calcDependency(), C.calcDependency(), D.calcDependency(), E.calcDependency(), F.calcDependency())
+func TestValueDependency(t *testing.T) {
+	for _, score := range []float64{0.9, 0.5} {
+		controller := NewTCController()
+		riskScore := controller.AddTask("riskScore", func(args map[string]interface{}) (interface{}, error) {
+			return args["BIND"], nil
+		}, score)
+		manualReview := controller.AddTask("manualReview", TaskDefault, 1)
+		autoApprove := controller.AddTask("autoApprove", TaskDefault, 2)
+
+		highRisk := func(value interface{}) bool { return value.(float64) > 0.8 }
+		manualReview.SetDependency(MakeValueExpr(manualReview, riskScore, highRisk))
+		autoApprove.SetDependency(MakeNotExpr(MakeValueExpr(autoApprove, riskScore, highRisk)))
+		controller.SetTermination(MakeOrExpr(controller.NewTerminationExpr(manualReview), controller.NewTerminationExpr(autoApprove)))
+
+		h := controller.Start()
+		res, err := h.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if score > 0.8 {
+			if _, exists := res["manualReview"]; !exists || h.Report().Task("autoApprove").Status != TaskSkipped {
+				t.Fatal("Result Error", res)
+			}
+		} else {
+			if _, exists := res["autoApprove"]; !exists || h.Report().Task("manualReview").Status != TaskSkipped {
+				t.Fatal("Result Error", res)
+			}
+		}
 	}
 
-	// 1 1   1  1  0  0
-	if !checkResult(true, true, true, true, false, false) {
-		t.Errorf("Error: A=%v, B=%v, C=%v, D=%v, E=%v, F=%v\n", A.calcDependency(), B.calcDependency(), C.calcDependency(), D.calcDependency(), E.calcDependency(), F.calcDependency())
+	A, B := newExecutor("A", nil, nil), newExecutor("B", nil, nil)
+	if s := MakeValueExpr(B, A, nil).String(); s != "value(A)" {
+		t.Fatal("String Error", s)
+	}
+	// a panicking predicate aborts the execution
+	controller := NewTCController()
+	undone := false
+	score := controller.AddTask("score", TaskDefault, 1).SetUndoFunc(func(args map[string]interface{}) error {
+		undone = true
+		return nil
+	}, false)
+	review := controller.AddTask("review", TaskDefault, 2)
+	review.SetDependency(MakeValueExpr(review, score, func(value interface{}) bool {
+		return value.(float64) > 0.8
+	}))
+	controller.SetTermination(controller.NewTerminationExpr(review))
+	_, err := controller.BatchRun()
+	aborted, ok := err.(ErrAborted)
+	if !ok || len(aborted.TaskErrors) != 1 || aborted.TaskErrors[0].TaskName != "review" {
+		t.Fatal(err)
+	}
+	if predicateErr, ok := aborted.TaskErrors[0].Error.(ErrPredicatePanic); !ok || predicateErr.TaskName != "score" {
+		t.Fatal(err)
+	}
+	if !undone {
+		t.Fatal("Undo Error")
 	}
+	t.Log(err)
 }
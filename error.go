@@ -1,6 +1,10 @@
 package gotcc
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // ---------- Executor-Level Errors -----------
 
@@ -24,6 +28,50 @@ func (e ErrSilentFail) Error() string {
 	return "Error: Task failed in silence."
 }
 
+// It means the task didn't finish within the timeout set by SetTimeout.
+// It is a fatal error, so the execution will be aborted.
+type ErrTaskTimeout struct {
+	Timeout time.Duration
+}
+
+func (e ErrTaskTimeout) Error() string {
+	return "Error: Task timed out after " + e.Timeout.String() + "."
+}
+
+// It means the task function panicked. Value is the value passed to panic() and Stack is
+// the stack trace of the panicking goroutine. It is a fatal error, so the execution will be aborted.
+type ErrTaskPanic struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e ErrTaskPanic) Error() string {
+	return fmt.Sprintf("Error: Task panicked: %v.", e.Value)
+}
+
+// It means the predicate of a value dependency on task TaskName panicked. Value is the value
+// passed to panic() and Stack is the stack trace. The execution is aborted.
+type ErrPredicatePanic struct {
+	TaskName string
+	Value    interface{}
+	Stack    []byte
+}
+
+func (e ErrPredicatePanic) Error() string {
+	return fmt.Sprintf("Error: Value predicate on task %s panicked: %v.", e.TaskName, e.Value)
+}
+
+// It means the undo function panicked. Value is the value passed to panic() and Stack is
+// the stack trace of the panicking goroutine. It is handled like other undo errors.
+type ErrUndoPanic struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e ErrUndoPanic) Error() string {
+	return fmt.Sprintf("Error: Undo panicked: %v.", e.Value)
+}
+
 // ---------- Controller-Level Errors -----------
 
 // It means the controller's termination condition haven't been set.
@@ -33,29 +81,223 @@ func (ErrNoTermination) Error() string {
 	return "Error: No termination condition has been set!"
 }
 
-// It means there is loop dependency among the tasks.
+// It means the controller has no task named TaskName.
+type ErrTaskNotFound struct {
+	TaskName string
+}
+
+func (e ErrTaskNotFound) Error() string {
+	return fmt.Sprintf("Error: Task %s not found.", e.TaskName)
+}
+
+// It means task TaskName can't be removed, because the dependency expressions of UsedBy
+// still reference it.
+type ErrTaskInUse struct {
+	TaskName string
+	UsedBy   []string
+}
+
+func (e ErrTaskInUse) Error() string {
+	return fmt.Sprintf("Error: Task %s is still used by %s.", e.TaskName, strings.Join(e.UsedBy, ", "))
+}
+
+// It means several tasks of the controller have the same name, so they overwrite each
+// other in the results and args.
+type ErrDuplicateName struct {
+	TaskName string
+	Count    int
+}
+
+func (e ErrDuplicateName) Error() string {
+	return fmt.Sprintf("Error: %d tasks are named %s.", e.Count, e.TaskName)
+}
+
+// It means the name of a task collides with a built-in key of args, such as BIND or CANCEL.
+type ErrReservedName struct {
+	TaskName string
+}
+
+func (e ErrReservedName) Error() string {
+	return fmt.Sprintf("Error: Task name %s is reserved.", e.TaskName)
+}
+
+// It means task TaskName depends on executor Dependency, which doesn't belong to the controller.
+type ErrForeignExecutor struct {
+	TaskName   string
+	Dependency string
+}
+
+func (e ErrForeignExecutor) Error() string {
+	return fmt.Sprintf("Error: Task %s depends on %s, which is not a task of the controller.", e.TaskName, e.Dependency)
+}
+
+// It means the result of upstream task Input is not of the input type of typed task TaskName.
+type ErrInputType struct {
+	TaskName string
+	Input    string
+	Expected string
+	Actual   string
+}
+
+func (e ErrInputType) Error() string {
+	return fmt.Sprintf("Error: Input %s of task %s is %s, not %s.", e.Input, e.TaskName, e.Actual, e.Expected)
+}
+
+// It means the termination doesn't depend on task TaskName, directly or indirectly.
+type ErrUnreachable struct {
+	TaskName string
+}
+
+func (e ErrUnreachable) Error() string {
+	return fmt.Sprintf("Error: Task %s can't reach the termination.", e.TaskName)
+}
+
+// It means there is loop dependency among the tasks. Cycles: the distinct cycles of task
+// names, where every task depends on the next one, and the last one depends on the first one.
 type ErrLoopDependency struct {
-	State State
+	Cycles [][]string
 }
 
 func (e ErrLoopDependency) Error() string {
-	return "Error: Tasks has loop dependency."
+	var sb strings.Builder
+	sb.WriteString("Error: Tasks has loop dependency.")
+	for _, cycle := range e.Cycles {
+		sb.WriteString("\n")
+		for _, name := range cycle {
+			sb.WriteString(name)
+			sb.WriteString(" -> ")
+		}
+		sb.WriteString(cycle[0])
+	}
+	return sb.String()
 }
 
 // It means the controller doesn't support PoolRun() because not all dependency expressions are `AND`.
+//
+// Deprecated: PoolRun supports any dependency expression now, so it is never returned.
 type ErrPoolUnsupport struct{}
 
 func (ErrPoolUnsupport) Error() string {
 	return "Error: PoolRun is not support when any dependency is not AND!"
 }
 
+// It means the termination expression is false, but no task is running and no task can be
+// launched anymore, for example because some task returned ErrSilentFail. Pending: tasks
+// neither launched nor skipped and their dependency expressions. The completed tasks have been rolled back.
+type ErrStalled struct {
+	Pending     []*PendingTask
+	Termination DependencyExpression
+	TaskErrors  []*ErrorMessage
+	UndoErrors  []*ErrorMessage
+}
+
+// A task that has never been launched, and its dependency expression.
+type PendingTask struct {
+	TaskName   string
+	Dependency DependencyExpression
+}
+
+func (e ErrStalled) Error() string {
+	var sb strings.Builder
+	sb.WriteString("Error: Tasks stalled and the termination can never be reached.\n")
+	sb.WriteString("[?] Pending:\n")
+	for _, pt := range e.Pending {
+		sb.WriteString(pt.TaskName)
+		sb.WriteString(": ")
+		sb.WriteString(pt.Dependency.String())
+		sb.WriteString("\n")
+	}
+	sb.WriteString("[?] Termination: ")
+	sb.WriteString(e.Termination.String())
+	sb.WriteString("\n")
+	sb.WriteString("[x] TaskErrors:\n")
+	sb.WriteString((&errorLisk{items: e.TaskErrors}).String())
+	sb.WriteString("[-] UndoErrors:\n")
+	sb.WriteString((&errorLisk{items: e.UndoErrors}).String())
+	return sb.String()
+}
+
+// It means a task spawned by TaskName depends on Dependency, which is not spawned by
+// the same task.
+type ErrInvalidSpawn struct {
+	TaskName   string
+	Dependency string
+}
+
+func (e ErrInvalidSpawn) Error() string {
+	return fmt.Sprintf("Error: Task %s depends on %s, which is not spawned by the same task.", e.TaskName, e.Dependency)
+}
+
+// It means the sub controller of task TaskName can not be compiled.
+type ErrSubController struct {
+	TaskName string
+	Err      error
+}
+
+func (e ErrSubController) Error() string {
+	return fmt.Sprintf("Error: Sub controller %s: %v", e.TaskName, e.Err)
+}
+
+// Return the error of the sub controller, such as ErrLoopDependency.
+func (e ErrSubController) Unwrap() error {
+	return e.Err
+}
+
+// It means a workflow definition is wrong. TaskName is empty if the error is not about a task.
+type ErrWorkflow struct {
+	TaskName string
+	Err      error
+}
+
+func (e ErrWorkflow) Error() string {
+	if e.TaskName == "" {
+		return fmt.Sprintf("Error: Invalid workflow: %v", e.Err)
+	}
+	return fmt.Sprintf("Error: Invalid workflow task %s: %v", e.TaskName, e.Err)
+}
+
+// Return the underlying error, such as ErrExprSyntax.
+func (e ErrWorkflow) Unwrap() error {
+	return e.Err
+}
+
+// It means a dependency expression in text is wrong. Pos is the byte offset in Expr.
+type ErrExprSyntax struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func (e ErrExprSyntax) Error() string {
+	return fmt.Sprintf("Error: %s at position %d of %q.", e.Msg, e.Pos, e.Expr)
+}
+
+// It means a dependency expression can never be true given the graph, so the task would
+// never be launched, or the termination would never be reached. SubExpr is the smallest
+// sub-expression of Expr that can never be true.
+type ErrUnsatisfiable struct {
+	TaskName    string
+	Termination bool
+	Expr        DependencyExpression
+	SubExpr     DependencyExpression
+}
+
+func (e ErrUnsatisfiable) Error() string {
+	if e.Termination {
+		return fmt.Sprintf("Error: Termination can never be reached: %s (in %s).", e.SubExpr, e.Expr)
+	}
+	return fmt.Sprintf("Error: Dependency of task %s can never be true: %s (in %s).", e.TaskName, e.SubExpr, e.Expr)
+}
+
 // It means some fatal errors occur so the execution failed.
 // It consists of multiple errors. TaskErrors: errors from task running.
 // UndoErrors: errors from undo function running. Cancelled: running but cancelled tasks.
+// Cause: the error of the caller's context, if the execution is aborted by it.
 type ErrAborted struct {
 	TaskErrors []*ErrorMessage
 	UndoErrors []*ErrorMessage
 	Cancelled  []*StateMessage
+	Cause      error
 }
 
 func (e ErrAborted) Error() string {
@@ -66,6 +308,15 @@ func (e ErrAborted) Error() string {
 	sb.WriteString((&errorLisk{items: e.UndoErrors}).String())
 	sb.WriteString("[/] Cancelled:\n")
 	sb.WriteString((&cancelList{items: e.Cancelled}).String())
+	if e.Cause != nil {
+		sb.WriteString("[!] Cause: ")
+		sb.WriteString(e.Cause.Error())
+		sb.WriteString("\n")
+	}
 	return sb.String()
 }
 
+// Return the cause of the abortion, so that errors.Is(err, context.DeadlineExceeded) works.
+func (e ErrAborted) Unwrap() error {
+	return e.Cause
+}
@@ -1,6 +1,8 @@
 package gotcc
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -12,12 +14,23 @@ type Executor struct {
 	task          func(args map[string]interface{}) (interface{}, error)
 	undo          func(args map[string]interface{}) error
 	undoSkipError bool
+	timeout       time.Duration
+
+	retryAttempts int
+	retryBackoff  Backoff
+	retryable     func(err error) bool
 
 	dependency     map[uint32]bool
 	dependencyExpr DependencyExpression
 
-	messageBuffer chan message
-	subscribers   []*chan message
+	subscribers []uint32
+
+	// only for sub controllers
+	sub     *TCController
+	subPlan *Plan
+
+	// only for spawned tasks
+	spawner *Spawner
 }
 
 func newExecutor(name string, f func(args map[string]interface{}) (interface{}, error), args interface{}) *Executor {
@@ -28,8 +41,7 @@ func newExecutor(name string, f func(args map[string]interface{}) (interface{},
 		dependency:     map[uint32]bool{},
 		dependencyExpr: DefaultTrueExpr,
 
-		messageBuffer: make(chan message),
-		subscribers:   []*chan message{},
+		subscribers: []uint32{},
 
 		bindArgs: args,
 		task:     f,
@@ -40,12 +52,66 @@ func newExecutor(name string, f func(args map[string]interface{}) (interface{},
 // Create a dependency expression for the executor.
 // It means the task launching may depend on executor `d`.
 func (e *Executor) NewDependencyExpr(d *Executor) DependencyExpression {
+	e.subscribe(d)
+	return newLeafExpr(d, LeafSucceeded)
+}
+
+// Create a failure dependency expression for the executor.
+// It is true when executor `d` failed, for example returned ErrSilentFail.
+// So that a fallback task can be launched if `d` failed.
+func (e *Executor) NewFailureDependencyExpr(d *Executor) DependencyExpression {
+	e.subscribe(d)
+	return newLeafExpr(d, LeafFailed)
+}
+
+// Create a finished dependency expression for the executor.
+// It is true when executor `d` finished, no matter it succeeded or failed.
+func (e *Executor) NewFinishedDependencyExpr(d *Executor) DependencyExpression {
+	e.subscribe(d)
+	return newLeafExpr(d, LeafFinished)
+}
+
+func (e *Executor) subscribe(d *Executor) {
+	if e.spawner != d.spawner {
+		// a spawned task never touches the tasks out of its spawner, which may be in use.
+		// The dependency is rejected once the spawning task returns.
+		return
+	}
 	if _, exists := e.dependency[d.id]; !exists {
 		e.dependency[d.id] = false
-		e.messageBuffer = make(chan message, cap(e.messageBuffer)+1)
-		d.subscribers = append(d.subscribers, &e.messageBuffer)
+		d.subscribers = append(d.subscribers, e.id)
 	}
-	return newDependencyExpr(e.dependency, d.id)
+}
+
+func (e *Executor) unsubscribe(d *Executor) {
+	delete(e.dependency, d.id)
+	for i, id := range d.subscribers {
+		if id == e.id {
+			d.subscribers = append(d.subscribers[:i:i], d.subscribers[i+1:]...)
+			break
+		}
+	}
+}
+
+// Whether the dependency expression of the executor references executor `d`.
+func (e *Executor) references(d *Executor) bool {
+	for _, ref := range e.dependencyExpr.Executors() {
+		if ref.id == d.id {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove the dependency on executor `d`, which has been created by NewDependencyExpr or
+// other methods. If the dependency expression still references `d`, return ErrTaskInUse.
+// So set a new dependency expression without `d` first.
+func (e *Executor) Unsubscribe(d *Executor) error {
+	if e.references(d) {
+		return ErrTaskInUse{TaskName: d.name, UsedBy: []string{e.name}}
+	}
+	e.unsubscribe(d)
+	return nil
 }
 
 // Get dependency expression of the executor.
@@ -59,12 +125,15 @@ func (e *Executor) SetDependency(Expr DependencyExpression) *Executor {
 	return e
 }
 
-func (e *Executor) calcDependency() bool {
-	return e.dependencyExpr.f()
-}
-
-func (e *Executor) markDependency(id uint32, finished bool) {
-	e.dependency[id] = finished
+// Copy the executor, so that later modification of `e` won't affect the copy.
+func (e *Executor) freeze() *Executor {
+	frozen := *e
+	frozen.dependency = make(map[uint32]bool, len(e.dependency))
+	for id := range e.dependency {
+		frozen.dependency[id] = false
+	}
+	frozen.subscribers = append([]uint32{}, e.subscribers...)
+	return &frozen
 }
 
 // Set undo function the task executor. The undo function will get all arguments of the task function.
@@ -74,7 +143,45 @@ func (e *Executor) SetUndoFunc(undo func(args map[string]interface{}) error, ski
 	return e
 }
 
+// Replace the task function of the executor.
+func (e *Executor) SetTaskFunc(f func(args map[string]interface{}) (interface{}, error)) *Executor {
+	e.task = f
+	e.sub = nil
+	return e
+}
+
+// Replace the arguments bind with the task, which can be obtained from args["BIND"].
+func (e *Executor) SetBindArgs(args interface{}) *Executor {
+	e.bindArgs = args
+	return e
+}
+
 // Get task name of the executor.
 func (e *Executor) Name() string {
 	return e.name
 }
+
+// Set timeout of the task. If the task function doesn't return within `d`, the task fails
+// with ErrTaskTimeout and the execution is aborted. args["CANCEL"] of the task will be done
+// when the timeout expires. `d` <= 0 means no timeout.
+func (e *Executor) SetTimeout(d time.Duration) *Executor {
+	e.timeout = d
+	return e
+}
+
+// Set retry policy of the task. The task function will be called at most `maxAttempts` times,
+// until it succeeds or returns an error that `retryable` rejects. `backoff` decides how long
+// to wait before each retry. Nil `backoff` means no waiting and nil `retryable` means
+// DefaultRetryable. The current attempt number (from 1) can be obtained from args["ATTEMPT"].
+func (e *Executor) SetRetry(maxAttempts int, backoff Backoff, retryable func(err error) bool) *Executor {
+	if backoff == nil {
+		backoff = ConstantBackoff(0)
+	}
+	if retryable == nil {
+		retryable = DefaultRetryable
+	}
+	e.retryAttempts = maxAttempts
+	e.retryBackoff = backoff
+	e.retryable = retryable
+	return e
+}
@@ -0,0 +1,228 @@
+package gotcc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A node of the exported graph: a task, an operator gate or a constant.
+type graphNode struct {
+	id    string
+	label string
+	// "task", "gate", "const" or "termination"
+	shape  string
+	status TaskStatus
+	// whether status is known from a report
+	colored bool
+}
+
+// An edge of the exported graph. Label is the condition on the source task, if any.
+type graphEdge struct {
+	from  string
+	to    string
+	label string
+}
+
+type graphBuilder struct {
+	report *RunReport
+	nodes  []*graphNode
+	edges  []graphEdge
+	tasks  map[uint32]string
+	gates  int
+}
+
+// Build the graph of the controller. Tasks are sorted by name.
+func (m *TCController) buildGraph(report *RunReport) *graphBuilder {
+	g := &graphBuilder{report: report, tasks: map[uint32]string{}}
+	executors := make([]*Executor, 0, len(m.executors))
+	for _, e := range m.executors {
+		executors = append(executors, e)
+	}
+	sort.Slice(executors, func(i, j int) bool {
+		if executors[i].name == executors[j].name {
+			return executors[i].id < executors[j].id
+		}
+		return executors[i].name < executors[j].name
+	})
+	for _, e := range executors {
+		g.taskNode(e)
+	}
+	for _, e := range executors {
+		g.connect(e.dependencyExpr, g.tasks[e.id])
+	}
+	g.nodes = append(g.nodes, &graphNode{id: "termination", label: "TERMINATION", shape: "termination"})
+	g.connect(m.termination.dependencyExpr, "termination")
+	return g
+}
+
+func (g *graphBuilder) taskNode(e *Executor) string {
+	if id, exists := g.tasks[e.id]; exists {
+		return id
+	}
+	node := &graphNode{id: fmt.Sprintf("t%d", len(g.tasks)), label: e.name, shape: "task"}
+	if g.report != nil {
+		if tr := g.report.Task(e.name); tr != nil {
+			node.status, node.colored = tr.Status, true
+		}
+	}
+	g.tasks[e.id] = node.id
+	g.nodes = append(g.nodes, node)
+	return node.id
+}
+
+// Connect the output of `Expr` to node `to`.
+func (g *graphBuilder) connect(Expr DependencyExpression, to string) {
+	if Expr.kind == ExprTrue && to != "termination" {
+		// no dependency
+		return
+	}
+	from, label := g.exprNode(Expr)
+	g.edges = append(g.edges, graphEdge{from: from, to: to, label: label})
+}
+
+// Get the node of the output of `Expr`, and the label of its edge.
+func (g *graphBuilder) exprNode(Expr DependencyExpression) (string, string) {
+	var label string
+	switch Expr.kind {
+	case ExprLeaf:
+		return g.taskNode(Expr.task), map[LeafCondition]string{LeafFailed: "failed", LeafFinished: "finished", LeafValue: "value"}[Expr.condition]
+	case ExprTrue, ExprFalse:
+		g.gates++
+		node := &graphNode{id: fmt.Sprintf("g%d", g.gates), label: Expr.String(), shape: "const"}
+		g.nodes = append(g.nodes, node)
+		return node.id, ""
+	case ExprNot:
+		label = "NOT"
+	case ExprAnd:
+		label = "AND"
+	case ExprOr:
+		label = "OR"
+	case ExprXor:
+		label = "XOR"
+	case ExprAtLeast:
+		label = fmt.Sprintf("ATLEAST %d", Expr.threshold)
+	}
+	operands := Expr.operands
+	if Expr.kind == ExprAnd || Expr.kind == ExprOr {
+		operands = Expr.flatten()
+		if len(operands) == 0 {
+			return g.exprNode(map[ExprKind]DependencyExpression{ExprAnd: DefaultTrueExpr, ExprOr: DefaultFalseExpr}[Expr.kind])
+		}
+		if len(operands) == 1 {
+			return g.exprNode(operands[0])
+		}
+	}
+	g.gates++
+	node := &graphNode{id: fmt.Sprintf("g%d", g.gates), label: label, shape: "gate"}
+	g.nodes = append(g.nodes, node)
+	for _, operand := range operands {
+		from, edgeLabel := g.exprNode(operand)
+		g.edges = append(g.edges, graphEdge{from: from, to: node.id, label: edgeLabel})
+	}
+	return node.id, ""
+}
+
+// Fill colors of the task statuses.
+var statusColors = map[TaskStatus]string{
+	TaskNotLaunched:  "#ffffff",
+	TaskSucceeded:    "#b7e4b0",
+	TaskFailed:       "#f4a6a6",
+	TaskSilentFailed: "#f9d49a",
+	TaskCancelled:    "#d0d0d0",
+	TaskUndone:       "#f6ee9a",
+	TaskSkipped:      "#eeeeee",
+}
+
+// Export the task graph in Graphviz DOT. Tasks are boxes, operators are circles, and
+// the edges of failure, finished and value dependencies are labeled.
+func (m *TCController) ExportDOT() string {
+	return m.ExportDOTWithReport(nil)
+}
+
+// Like ExportDOT, but the tasks are colored by their status in `report`.
+func (m *TCController) ExportDOTWithReport(report *RunReport) string {
+	g := m.buildGraph(report)
+	var sb strings.Builder
+	sb.WriteString("digraph tcc {\n\trankdir=LR;\n")
+	for _, node := range g.nodes {
+		attrs := []string{"label=" + dotQuote(node.label)}
+		switch node.shape {
+		case "task":
+			attrs = append(attrs, "shape=box")
+			if node.colored {
+				attrs = append(attrs, "style=filled", "fillcolor="+dotQuote(statusColors[node.status]), "tooltip="+dotQuote(node.status.String()))
+			}
+		case "gate":
+			attrs = append(attrs, "shape=circle")
+		case "const":
+			attrs = append(attrs, "shape=plaintext")
+		case "termination":
+			attrs = append(attrs, "shape=doubleoctagon")
+		}
+		sb.WriteString(fmt.Sprintf("\t%s [%s];\n", node.id, strings.Join(attrs, ", ")))
+	}
+	for _, edge := range g.edges {
+		if edge.label == "" {
+			sb.WriteString(fmt.Sprintf("\t%s -> %s;\n", edge.from, edge.to))
+		} else {
+			sb.WriteString(fmt.Sprintf("\t%s -> %s [label=%s];\n", edge.from, edge.to, dotQuote(edge.label)))
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Export the task graph in Mermaid flowchart. Tasks are rectangles, operators are
+// hexagons, and the edges of failure, finished and value dependencies are labeled.
+func (m *TCController) ExportMermaid() string {
+	return m.ExportMermaidWithReport(nil)
+}
+
+// Like ExportMermaid, but the tasks are colored by their status in `report`.
+func (m *TCController) ExportMermaidWithReport(report *RunReport) string {
+	g := m.buildGraph(report)
+	var sb strings.Builder
+	sb.WriteString("flowchart LR\n")
+	classes := map[TaskStatus][]string{}
+	for _, node := range g.nodes {
+		label := mermaidQuote(node.label)
+		switch node.shape {
+		case "task":
+			sb.WriteString(fmt.Sprintf("\t%s[%s]\n", node.id, label))
+			if node.colored {
+				classes[node.status] = append(classes[node.status], node.id)
+			}
+		case "gate":
+			sb.WriteString(fmt.Sprintf("\t%s{{%s}}\n", node.id, label))
+		case "const":
+			sb.WriteString(fmt.Sprintf("\t%s(%s)\n", node.id, label))
+		case "termination":
+			sb.WriteString(fmt.Sprintf("\t%s(((%s)))\n", node.id, label))
+		}
+	}
+	for _, edge := range g.edges {
+		if edge.label == "" {
+			sb.WriteString(fmt.Sprintf("\t%s --> %s\n", edge.from, edge.to))
+		} else {
+			sb.WriteString(fmt.Sprintf("\t%s -->|%s| %s\n", edge.from, mermaidQuote(edge.label), edge.to))
+		}
+	}
+	for status := TaskNotLaunched; status <= TaskSkipped; status++ {
+		if len(classes[status]) == 0 {
+			continue
+		}
+		class := strings.ReplaceAll(status.String(), " ", "")
+		sb.WriteString(fmt.Sprintf("\tclassDef %s fill:%s\n", class, statusColors[status]))
+		sb.WriteString(fmt.Sprintf("\tclass %s %s\n", strings.Join(classes[status], ","), class))
+	}
+	return sb.String()
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.NewReplacer(`"`, "#quot;", "\n", " ").Replace(s) + `"`
+}
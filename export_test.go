@@ -0,0 +1,66 @@
+package gotcc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	controller := NewTCController()
+	A := controller.AddTask("A", TaskDefault, 1)
+	B := controller.AddTask("B", TaskSilentFail, 2)
+	C := controller.AddTask("C", TaskDefault, 3)
+	D := controller.AddTask(`say "hi"`, TaskDefault, 4)
+
+	C.SetDependency(MakeAndExpr(C.NewDependencyExpr(A), MakeOrExpr(C.NewFailureDependencyExpr(B), MakeNotExpr(C.NewDependencyExpr(B)))))
+	D.SetDependency(D.NewFinishedDependencyExpr(B))
+	controller.SetTermination(MakeAllOfExpr(controller.NewTerminationExpr(C), controller.NewTerminationExpr(D)))
+
+	dot := controller.ExportDOT()
+	for _, line := range []string{
+		"\tt0 [label=\"A\", shape=box];",
+		"\tt3 [label=\"say \\\"hi\\\"\", shape=box];",
+		"\tg1 [label=\"AND\", shape=circle];",
+		"\tt0 -> g1;",
+		"\tg2 [label=\"OR\", shape=circle];",
+		"\tg3 [label=\"NOT\", shape=circle];",
+		"\tt1 -> g2 [label=\"failed\"];",
+		"\tt1 -> g3;",
+		"\tg1 -> t2;",
+		"\tt1 -> t3 [label=\"finished\"];",
+		"\tg4 -> termination;",
+	} {
+		if !strings.Contains(dot, line) {
+			t.Fatal("DOT Error", line, dot)
+		}
+	}
+	if strings.Contains(dot, "fillcolor") {
+		t.Fatal("DOT Error", dot)
+	}
+
+	h := controller.Start()
+	if _, err := h.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	dot = controller.ExportDOTWithReport(h.Report())
+	if !strings.Contains(dot, "\tt1 [label=\"B\", shape=box, style=filled, fillcolor=\"#f9d49a\", tooltip=\"silently failed\"];") {
+		t.Fatal("DOT Error", dot)
+	}
+
+	mermaid := controller.ExportMermaidWithReport(h.Report())
+	for _, line := range []string{
+		"flowchart LR\n",
+		"\tt3[\"say #quot;hi#quot;\"]\n",
+		"\tg1{{\"AND\"}}\n",
+		"\tt1 -->|\"failed\"| g2\n",
+		"\ttermination(((\"TERMINATION\")))\n",
+		"\tclassDef succeeded fill:#b7e4b0\n",
+		"\tclass t0,t2,t3 succeeded\n",
+	} {
+		if !strings.Contains(mermaid, line) {
+			t.Fatal("Mermaid Error", line, mermaid)
+		}
+	}
+	t.Log(dot)
+	t.Log(mermaid)
+}
@@ -1,8 +1,9 @@
 module github.com/piaodazhu/gotcc
 
-go 1.14
+go 1.18
 
 require (
 	github.com/google/uuid v1.3.0
 	github.com/panjf2000/ants/v2 v2.7.3
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,160 @@
+package gotcc
+
+import (
+	"context"
+	"errors"
+)
+
+// Status of an asynchronous run.
+type RunStatus int
+
+const (
+	RunRunning RunStatus = iota
+	RunSucceeded
+	RunFailed
+	RunCancelled
+)
+
+func (s RunStatus) String() string {
+	switch s {
+	case RunRunning:
+		return "running"
+	case RunSucceeded:
+		return "succeeded"
+	case RunFailed:
+		return "failed"
+	case RunCancelled:
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+// Result of a termination dependent task.
+type TaskResult struct {
+	TaskName string
+	Value    interface{}
+}
+
+// Handle of an asynchronous run, returned by Start() or StartPool().
+type RunHandle struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	stream chan TaskResult
+
+	results map[string]interface{}
+	err     error
+	report  *RunReport
+}
+
+func (p *Plan) startRun(run func(r *execution) (map[string]interface{}, error)) *RunHandle {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &RunHandle{
+		cancel: cancel,
+		done:   make(chan struct{}),
+		// every termination dependent task sends at most one result
+		stream: make(chan TaskResult, len(p.termination.dependency)),
+	}
+	r := p.newExecution(ctx, func(name string, value interface{}) {
+		h.stream <- TaskResult{TaskName: name, Value: value}
+	})
+	go func() {
+		defer cancel()
+		h.results, h.err = run(r)
+		h.report = r.report()
+		close(h.stream)
+		close(h.done)
+	}()
+	return h
+}
+
+func failedRun(err error) *RunHandle {
+	h := &RunHandle{
+		cancel: func() {},
+		done:   make(chan struct{}),
+		stream: make(chan TaskResult),
+		err:    err,
+	}
+	close(h.stream)
+	close(h.done)
+	return h
+}
+
+// Start the execution in background, like BatchRun.
+func (m *TCController) Start() *RunHandle {
+	plan, err := m.Compile()
+	if err != nil {
+		return failedRun(err)
+	}
+	return plan.Start()
+}
+
+// Start the execution with a Coroutine Pool in background, like PoolRun.
+func (m *TCController) StartPool(pool GoroutinePool) *RunHandle {
+	plan, err := m.Compile()
+	if err != nil {
+		return failedRun(err)
+	}
+	return plan.StartPool(pool)
+}
+
+// Start the plan in background, like BatchRun.
+func (p *Plan) Start() *RunHandle {
+	return p.startRun(p.batchRun)
+}
+
+// Start the plan with a Coroutine Pool in background, like PoolRun.
+func (p *Plan) StartPool(pool GoroutinePool) *RunHandle {
+	return p.startRun(func(r *execution) (map[string]interface{}, error) {
+		return r.schedule(pool)
+	})
+}
+
+// Wait until the run finishes, and return the same results and error as BatchRun or PoolRun.
+func (h *RunHandle) Wait() (map[string]interface{}, error) {
+	<-h.done
+	return h.results, h.err
+}
+
+// Cancel the run. The execution will be aborted and rolled back, and Wait() will return
+// an ErrAborted with Cause context.Canceled. It has no effect if the run has finished.
+func (h *RunHandle) Cancel() {
+	h.cancel()
+}
+
+// Return a channel that is closed when the run finishes.
+func (h *RunHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Return a channel that receives the result of each termination dependent task as soon as
+// that task finishes. It is closed when the run finishes.
+func (h *RunHandle) Results() <-chan TaskResult {
+	return h.stream
+}
+
+// Get the outcome of every task of the run. It returns nil until the run finishes,
+// or if the controller failed to compile.
+func (h *RunHandle) Report() *RunReport {
+	select {
+	case <-h.done:
+		return h.report
+	default:
+		return nil
+	}
+}
+
+// Get the current status of the run.
+func (h *RunHandle) Status() RunStatus {
+	select {
+	case <-h.done:
+	default:
+		return RunRunning
+	}
+	if h.err == nil {
+		return RunSucceeded
+	}
+	if errors.Is(h.err, context.Canceled) {
+		return RunCancelled
+	}
+	return RunFailed
+}
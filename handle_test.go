@@ -0,0 +1,162 @@
+package gotcc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunHandle(t *testing.T) {
+	controller := NewTCController()
+	A := controller.AddTask("A", TaskDefault, 1)
+	B := controller.AddTask("B", TaskMayFailedOrCancelled, argsForTest{id: 2, sleepTime: 10})
+	C := controller.AddTask("C", TaskDefault, 3)
+
+	C.SetDependency(MakeAndExpr(C.NewDependencyExpr(A), C.NewDependencyExpr(B)))
+	controller.SetTermination(controller.NewTerminationExpr(C))
+
+	h := controller.Start()
+	if h.Status() != RunRunning {
+		t.Fatal("Status Error", h.Status())
+	}
+	<-h.Done()
+	res, err := h.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := res["C"]; sum != 4 {
+		t.Fatal("Sum Error", sum)
+	}
+	if h.Status() != RunSucceeded {
+		t.Fatal("Status Error", h.Status())
+	}
+
+	// cancel from outside
+	controller = NewTCController()
+	A = controller.AddTask("A", TaskDefault, 1)
+	B = controller.AddTask("B", TaskMayFailedOrCancelled, argsForTest{id: 2, sleepTime: 1000})
+	controller.SetTermination(MakeAndExpr(controller.NewTerminationExpr(A), controller.NewTerminationExpr(B)))
+	pool := NewDefaultPool(2)
+	defer pool.Close()
+	h = controller.StartPool(pool)
+	time.Sleep(10 * time.Millisecond)
+	h.Cancel()
+	select {
+	case <-h.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Cancel Error")
+	}
+	if _, err := h.Wait(); !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	if h.Status() != RunCancelled {
+		t.Fatal("Status Error", h.Status())
+	}
+
+	// compile error
+	h = NewTCController().Start()
+	if _, err := h.Wait(); err == nil {
+		t.Fatal("should error")
+	}
+	if h.Status() != RunFailed {
+		t.Fatal("Status Error", h.Status())
+	}
+}
+
+func TestStreamResults(t *testing.T) {
+	controller := NewTCController()
+	A := controller.AddTask("A", TaskDefault, 1)
+	B := controller.AddTask("B", TaskMayFailedOrCancelled, argsForTest{id: 2, sleepTime: 100})
+	controller.SetTermination(MakeAndExpr(controller.NewTerminationExpr(A), controller.NewTerminationExpr(B)))
+
+	h := controller.Start()
+	first := <-h.Results()
+	if first.TaskName != "A" || first.Value != 1 {
+		t.Fatal("Result Error", first)
+	}
+	if h.Status() != RunRunning {
+		t.Fatal("Status Error", h.Status())
+	}
+	second := <-h.Results()
+	if second.TaskName != "B" || second.Value != "DONE" {
+		t.Fatal("Result Error", second)
+	}
+	if _, ok := <-h.Results(); ok {
+		t.Fatal("Results not closed")
+	}
+	if _, err := h.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	controller := NewTCController()
+	A := controller.AddTask("A", TaskDefault, 1).SetUndoFunc(EmptyUndoFunc, false)
+	B := controller.AddTask("B", TaskSilentFail, nil)
+	C := controller.AddTask("C", TaskDefault, 3)
+	D := controller.AddTask("D", TaskDefault, 4)
+
+	C.SetDependency(MakeOrExpr(C.NewDependencyExpr(A), C.NewDependencyExpr(B)))
+	D.SetDependency(D.NewDependencyExpr(C))
+	controller.SetTermination(controller.NewTerminationExpr(D))
+
+	h := controller.Start()
+	if _, err := h.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	report := h.Report()
+	t.Log(report)
+	expected := map[string]TaskStatus{"A": TaskSucceeded, "B": TaskSilentFailed, "C": TaskSucceeded, "D": TaskSucceeded}
+	for name, status := range expected {
+		if tr := report.Task(name); tr == nil || tr.Status != status {
+			t.Fatal("Status Error", name, tr)
+		}
+	}
+	if tr := report.Task("C"); tr.Result != 4 || tr.StartTime.Before(report.StartTime) || tr.EndTime.After(report.EndTime) {
+		t.Fatal("Report Error", tr)
+	}
+
+	// A is undone, C failed and D is never launched
+	C.task = TaskMustFail
+	h = controller.Start()
+	if _, err := h.Wait(); err == nil {
+		t.Fatal("Task not fail!")
+	}
+	report = h.Report()
+	t.Log(report)
+	expected = map[string]TaskStatus{"A": TaskUndone, "B": TaskSilentFailed, "C": TaskFailed, "D": TaskNotLaunched}
+	for name, status := range expected {
+		if tr := report.Task(name); tr == nil || tr.Status != status {
+			t.Fatal("Status Error", name, tr)
+		}
+	}
+	if report.Task("E") != nil {
+		t.Fatal("Report Error")
+	}
+
+	// the report of a synchronous run
+	C.task = TaskDefault
+	report, res, err := controller.Run(context.Background())
+	if err != nil || res["D"] != 8 {
+		t.Fatal(res, err)
+	}
+	if tr := report.Task("B"); tr == nil || tr.Status != TaskSilentFailed {
+		t.Fatal("Status Error", tr)
+	}
+	pool := NewDefaultPool(2)
+	defer pool.Close()
+	C.task = TaskMustFail
+	report, _, err = controller.RunPool(context.Background(), pool)
+	if _, ok := err.(ErrAborted); !ok {
+		t.Fatal(err)
+	}
+	if tr := report.Task("C"); tr == nil || tr.Status != TaskFailed {
+		t.Fatal("Status Error", tr)
+	}
+
+	// no report if the controller failed to compile
+	if report, _, err := NewTCController().Run(context.Background()); report != nil || err == nil {
+		t.Fatal(report, err)
+	}
+}
@@ -1,19 +1,29 @@
 package gotcc
 
 import (
+	"fmt"
 	"strings"
 	"sync"
 )
 
+// Sent by a task to the scheduler when the task finished.
 type message struct {
-	senderId   uint32
-	senderName string
-	value      interface{}
+	sender        *Executor
+	args          map[string]interface{}
+	value         interface{}
+	err           error
+	attemptErrors []error
+	// tasks spawned by the sender
+	spawned []*Executor
 }
 
+// Error of a task or an undo function. For a task, Attempts is how many times the task
+// function has been called, and AttemptErrors are the errors returned by each attempt.
 type ErrorMessage struct {
-	TaskName string
-	Error    error
+	TaskName      string
+	Error         error
+	Attempts      int
+	AttemptErrors []error
 }
 
 func newErrorMessage(taskName string, err error) *ErrorMessage {
@@ -23,6 +33,15 @@ func newErrorMessage(taskName string, err error) *ErrorMessage {
 	}
 }
 
+func newTaskErrorMessage(taskName string, err error, attemptErrors []error) *ErrorMessage {
+	return &ErrorMessage{
+		TaskName:      taskName,
+		Error:         err,
+		Attempts:      len(attemptErrors),
+		AttemptErrors: attemptErrors,
+	}
+}
+
 type errorLisk struct {
 	lock  sync.Mutex
 	items []*ErrorMessage
@@ -34,12 +53,6 @@ func (el *errorLisk) append(em *ErrorMessage) {
 	el.lock.Unlock()
 }
 
-func (el *errorLisk) reset() {
-	el.lock.Lock()
-	el.items = []*ErrorMessage{}
-	el.lock.Unlock()
-}
-
 func (el *errorLisk) String() string {
 	var sb strings.Builder
 	el.lock.Lock()
@@ -47,6 +60,9 @@ func (el *errorLisk) String() string {
 		sb.WriteString(el.items[i].TaskName)
 		sb.WriteString(": ")
 		sb.WriteString(el.items[i].Error.Error())
+		if el.items[i].Attempts > 1 {
+			sb.WriteString(fmt.Sprintf(" (after %d attempts)", el.items[i].Attempts))
+		}
 		sb.WriteString("\n")
 	}
 	el.lock.Unlock()
@@ -80,19 +96,15 @@ func (cl *cancelList) append(sm *StateMessage) {
 	cl.lock.Unlock()
 }
 
-func (cl *cancelList) reset() {
-	cl.lock.Lock()
-	cl.items = []*StateMessage{}
-	cl.lock.Unlock()
-}
-
 func (cl *cancelList) String() string {
 	var sb strings.Builder
 	cl.lock.Lock()
 	for i := range cl.items {
 		sb.WriteString(cl.items[i].TaskName)
 		sb.WriteString(": ")
-		sb.WriteString(cl.items[i].State.String())
+		if cl.items[i].State != nil {
+			sb.WriteString(cl.items[i].State.String())
+		}
 		sb.WriteString("\n")
 	}
 	cl.lock.Unlock()
@@ -0,0 +1,399 @@
+package gotcc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Parse a dependency expression of executor `e` from text, such as "A && (B || !C)".
+// Task names are resolved among the tasks of controller `m`, and the leaves are created by
+// e.NewDependencyExpr(). See ParseTerminationExpr for the syntax.
+func ParseDependencyExpr(m *TCController, e *Executor, expr string) (DependencyExpression, error) {
+	return m.parseExpr(e, expr)
+}
+
+// Parse a termination expression of controller `m` from text. Syntax, from the lowest precedence:
+//
+//	A || B               true if A or B is true
+//	A ^ B                true if only one of A and B is true
+//	A && B               true if A and B are true
+//	!A                   true if A is false
+//	(A)                  grouping
+//	name                 true if the task succeeded, "quoted name" for special characters
+//	failed(name)         true if the task failed
+//	finished(name)       true if the task finished
+//	atleast(k, A, B...)  true if at least k of the expressions are true
+//	true, false          constants
+//
+// Syntax errors and unknown task names are returned as ErrExprSyntax with the position.
+func ParseTerminationExpr(m *TCController, expr string) (DependencyExpression, error) {
+	return m.parseExpr(m.termination, expr)
+}
+
+// Parse `expr` and set it as the dependency expression of executor `e`.
+func (m *TCController) SetDependencyString(e *Executor, expr string) error {
+	Expr, err := ParseDependencyExpr(m, e, expr)
+	if err != nil {
+		return err
+	}
+	e.SetDependency(Expr)
+	return nil
+}
+
+// Parse `expr` and set it as the termination expression of the controller.
+func (m *TCController) SetTerminationString(expr string) error {
+	Expr, err := ParseTerminationExpr(m, expr)
+	if err != nil {
+		return err
+	}
+	m.SetTermination(Expr)
+	return nil
+}
+
+func (m *TCController) parseExpr(e *Executor, expr string) (DependencyExpression, error) {
+	names := map[string]*Executor{}
+	ambiguous := map[string]bool{}
+	for _, d := range m.executors {
+		if _, exists := names[d.name]; exists {
+			ambiguous[d.name] = true
+		}
+		names[d.name] = d
+	}
+	resolve := func(name string, pos int) (*Executor, error) {
+		if ambiguous[name] {
+			return nil, ErrExprSyntax{Expr: expr, Pos: pos, Msg: "ambiguous task name " + strconv.Quote(name)}
+		}
+		d, exists := names[name]
+		if !exists {
+			return nil, ErrExprSyntax{Expr: expr, Pos: pos, Msg: "unknown task " + strconv.Quote(name)}
+		}
+		return d, nil
+	}
+
+	// check the whole expression first, so that no dependency is added if it is wrong
+	dryRun := &exprParser{expr: expr, leaf: func(name string, condition LeafCondition, pos int) (DependencyExpression, error) {
+		_, err := resolve(name, pos)
+		return DefaultTrueExpr, err
+	}}
+	if _, err := dryRun.parse(); err != nil {
+		return DependencyExpression{}, err
+	}
+
+	p := &exprParser{expr: expr, leaf: func(name string, condition LeafCondition, pos int) (DependencyExpression, error) {
+		d, err := resolve(name, pos)
+		if err != nil {
+			return DependencyExpression{}, err
+		}
+		switch condition {
+		case LeafFailed:
+			return e.NewFailureDependencyExpr(d), nil
+		case LeafFinished:
+			return e.NewFinishedDependencyExpr(d), nil
+		}
+		return e.NewDependencyExpr(d), nil
+	}}
+	return p.parse()
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenNumber
+	tokenLParen
+	tokenRParen
+	tokenComma
+	tokenNot
+	tokenAnd
+	tokenOr
+	tokenXor
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// A recursive descent parser of dependency expressions.
+type exprParser struct {
+	expr string
+	pos  int
+	tok  token
+	leaf func(name string, condition LeafCondition, pos int) (DependencyExpression, error)
+}
+
+func (p *exprParser) parse() (DependencyExpression, error) {
+	if err := p.next(); err != nil {
+		return DependencyExpression{}, err
+	}
+	Expr, err := p.parseOr()
+	if err != nil {
+		return DependencyExpression{}, err
+	}
+	if p.tok.kind != tokenEOF {
+		return DependencyExpression{}, p.errorf("unexpected %q", p.tok.text)
+	}
+	return Expr, nil
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return ErrExprSyntax{Expr: p.expr, Pos: p.tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func isNameRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune("()!&|^,\"", r)
+}
+
+// Read the next token.
+func (p *exprParser) next() error {
+	for p.pos < len(p.expr) {
+		r, size := utf8.DecodeRuneInString(p.expr[p.pos:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		p.pos += size
+	}
+	start := p.pos
+	if p.pos >= len(p.expr) {
+		p.tok = token{kind: tokenEOF, text: "end of expression", pos: start}
+		return nil
+	}
+
+	two := ""
+	if p.pos+1 < len(p.expr) {
+		two = p.expr[p.pos : p.pos+2]
+	}
+	switch {
+	case two == "&&":
+		p.pos += 2
+		p.tok = token{kind: tokenAnd, text: two, pos: start}
+	case two == "||":
+		p.pos += 2
+		p.tok = token{kind: tokenOr, text: two, pos: start}
+	case strings.ContainsRune("()!^,", rune(p.expr[p.pos])):
+		kinds := map[byte]tokenKind{'(': tokenLParen, ')': tokenRParen, '!': tokenNot, '^': tokenXor, ',': tokenComma}
+		p.tok = token{kind: kinds[p.expr[p.pos]], text: p.expr[p.pos : p.pos+1], pos: start}
+		p.pos++
+	case p.expr[p.pos] == '"':
+		// quoted name
+		end := p.pos + 1
+		for end < len(p.expr) && p.expr[end] != '"' {
+			if p.expr[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(p.expr) {
+			p.tok = token{pos: start}
+			return p.errorf("unterminated quoted name")
+		}
+		name, err := strconv.Unquote(p.expr[p.pos : end+1])
+		if err != nil {
+			p.tok = token{pos: start}
+			return p.errorf("invalid quoted name")
+		}
+		p.pos = end + 1
+		p.tok = token{kind: tokenName, text: name, pos: start}
+	default:
+		for p.pos < len(p.expr) {
+			r, size := utf8.DecodeRuneInString(p.expr[p.pos:])
+			if !isNameRune(r) {
+				break
+			}
+			p.pos += size
+		}
+		if p.pos == start {
+			p.tok = token{pos: start}
+			return p.errorf("unexpected %q", p.expr[start:start+1])
+		}
+		p.tok = token{kind: tokenName, text: p.expr[start:p.pos], pos: start}
+		if _, err := strconv.Atoi(p.tok.text); err == nil {
+			p.tok.kind = tokenNumber
+		}
+	}
+	return nil
+}
+
+func (p *exprParser) expect(kind tokenKind, text string) error {
+	if p.tok.kind != kind {
+		return p.errorf("expected %s but got %q", text, p.tok.text)
+	}
+	return p.next()
+}
+
+// or := xor { "||" xor }
+func (p *exprParser) parseOr() (DependencyExpression, error) {
+	Expr, err := p.parseXor()
+	if err != nil {
+		return Expr, err
+	}
+	for p.tok.kind == tokenOr {
+		if err := p.next(); err != nil {
+			return Expr, err
+		}
+		operand, err := p.parseXor()
+		if err != nil {
+			return Expr, err
+		}
+		Expr = MakeOrExpr(Expr, operand)
+	}
+	return Expr, nil
+}
+
+// xor := and { "^" and }
+func (p *exprParser) parseXor() (DependencyExpression, error) {
+	Expr, err := p.parseAnd()
+	if err != nil {
+		return Expr, err
+	}
+	for p.tok.kind == tokenXor {
+		if err := p.next(); err != nil {
+			return Expr, err
+		}
+		operand, err := p.parseAnd()
+		if err != nil {
+			return Expr, err
+		}
+		Expr = MakeXorExpr(Expr, operand)
+	}
+	return Expr, nil
+}
+
+// and := unary { "&&" unary }
+func (p *exprParser) parseAnd() (DependencyExpression, error) {
+	Expr, err := p.parseUnary()
+	if err != nil {
+		return Expr, err
+	}
+	for p.tok.kind == tokenAnd {
+		if err := p.next(); err != nil {
+			return Expr, err
+		}
+		operand, err := p.parseUnary()
+		if err != nil {
+			return Expr, err
+		}
+		Expr = MakeAndExpr(Expr, operand)
+	}
+	return Expr, nil
+}
+
+// unary := "!" unary | primary
+func (p *exprParser) parseUnary() (DependencyExpression, error) {
+	if p.tok.kind == tokenNot {
+		if err := p.next(); err != nil {
+			return DependencyExpression{}, err
+		}
+		Expr, err := p.parseUnary()
+		if err != nil {
+			return Expr, err
+		}
+		return MakeNotExpr(Expr), nil
+	}
+	return p.parsePrimary()
+}
+
+// primary := "(" or ")" | "true" | "false" | name | "failed" "(" name ")" |
+// "finished" "(" name ")" | "atleast" "(" number { "," or } ")"
+func (p *exprParser) parsePrimary() (DependencyExpression, error) {
+	switch p.tok.kind {
+	case tokenLParen:
+		if err := p.next(); err != nil {
+			return DependencyExpression{}, err
+		}
+		Expr, err := p.parseOr()
+		if err != nil {
+			return Expr, err
+		}
+		return Expr, p.expect(tokenRParen, "\")\"")
+	case tokenName, tokenNumber:
+	default:
+		return DependencyExpression{}, p.errorf("expected a task name but got %q", p.tok.text)
+	}
+
+	name, pos := p.tok, p.tok.pos
+	quoted := p.expr[pos] == '"'
+	if err := p.next(); err != nil {
+		return DependencyExpression{}, err
+	}
+	if quoted {
+		return p.leaf(name.text, LeafSucceeded, pos)
+	}
+	switch name.text {
+	case "true":
+		return DefaultTrueExpr, nil
+	case "false":
+		return DefaultFalseExpr, nil
+	case "failed", "finished":
+		if p.tok.kind != tokenLParen {
+			break
+		}
+		if err := p.next(); err != nil {
+			return DependencyExpression{}, err
+		}
+		if p.tok.kind != tokenName && p.tok.kind != tokenNumber {
+			return DependencyExpression{}, p.errorf("expected a task name but got %q", p.tok.text)
+		}
+		task, taskPos := p.tok.text, p.tok.pos
+		if err := p.next(); err != nil {
+			return DependencyExpression{}, err
+		}
+		if err := p.expect(tokenRParen, "\")\""); err != nil {
+			return DependencyExpression{}, err
+		}
+		condition := LeafFailed
+		if name.text == "finished" {
+			condition = LeafFinished
+		}
+		return p.leaf(task, condition, taskPos)
+	case "atleast":
+		if p.tok.kind != tokenLParen {
+			break
+		}
+		if err := p.next(); err != nil {
+			return DependencyExpression{}, err
+		}
+		if p.tok.kind != tokenNumber {
+			return DependencyExpression{}, p.errorf("expected a number but got %q", p.tok.text)
+		}
+		k, _ := strconv.Atoi(p.tok.text)
+		if err := p.next(); err != nil {
+			return DependencyExpression{}, err
+		}
+		Exprs := []DependencyExpression{}
+		for p.tok.kind == tokenComma {
+			if err := p.next(); err != nil {
+				return DependencyExpression{}, err
+			}
+			Expr, err := p.parseOr()
+			if err != nil {
+				return Expr, err
+			}
+			Exprs = append(Exprs, Expr)
+		}
+		if err := p.expect(tokenRParen, "\",\" or \")\""); err != nil {
+			return DependencyExpression{}, err
+		}
+		return MakeAtLeastExpr(k, Exprs...), nil
+	}
+	return p.leaf(name.text, LeafSucceeded, pos)
+}
+
+// Quote the task name in an expression if necessary.
+func quoteName(name string) string {
+	switch name {
+	case "", "true", "false":
+		return strconv.Quote(name)
+	}
+	for _, r := range name {
+		if !isNameRune(r) {
+			return strconv.Quote(name)
+		}
+	}
+	return name
+}
@@ -0,0 +1,103 @@
+package gotcc
+
+import "testing"
+
+func TestParseDependencyExpr(t *testing.T) {
+	controller := NewTCController()
+	A := controller.AddTask("A", TaskDefault, 1)
+	controller.AddTask("B", TaskSilentFail, 2)
+	C := controller.AddTask("C", TaskDefault, 3)
+	D := controller.AddTask("task D", TaskDefault, 4)
+	E := controller.AddTask("E", TaskDefault, 5)
+
+	if err := controller.SetDependencyString(C, "A && (B || !finished(B))"); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.SetDependencyString(D, "failed(B) ^ false"); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.SetDependencyString(E, `atleast(2, A, C, "task D") && true`); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.SetTerminationString(`E && "task D"`); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[*Executor]string{
+		C: "A && (B || !finished(B))",
+		D: "failed(B) ^ false",
+		E: `atleast(2, A, C, "task D") && true`,
+	}
+	for e, s := range expected {
+		if e.DependencyExpr().String() != s {
+			t.Fatal("String Error", e.DependencyExpr().String(), s)
+		}
+		// round trip
+		Expr, err := ParseDependencyExpr(controller, e, e.DependencyExpr().String())
+		if err != nil || Expr.String() != s {
+			t.Fatal("Parse Error", Expr.String(), err)
+		}
+	}
+	if s := controller.TerminationExpr().String(); s != `E && "task D"` {
+		t.Fatal("String Error", s)
+	}
+	if len(A.subscribers) != 2 {
+		t.Fatal("Subscribers Error", A.subscribers)
+	}
+
+	// A=1, B failed, C never launched, D=4, E=5+1+4
+	res, err := controller.BatchRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["E"] != 10 || res["task D"] != 4 {
+		t.Fatal("Result Error", res)
+	}
+
+	// A || B ^ C && !D is A || (B ^ (C && !D))
+	Expr, err := ParseTerminationExpr(controller, "A || B ^ C && !E")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Expr.String() != "A || (B ^ (C && !E))" {
+		t.Fatal("Precedence Error", Expr.String())
+	}
+}
+
+func TestParseDependencyExprError(t *testing.T) {
+	controller := NewTCController()
+	A := controller.AddTask("A", TaskDefault, 1)
+	controller.AddTask("B", TaskDefault, 2)
+	controller.AddTask("B", TaskDefault, 2)
+
+	expected := map[string]int{
+		"A && X":           5,
+		"A && (A || A":     12,
+		"A &&":             4,
+		"A B":              2,
+		"failed(":          7,
+		"atleast(x, A)":    8,
+		"A & A":            2,
+		`"A`:               0,
+		"B":                0,
+		"A && finished(X)": 14,
+		"atleast(1, A; A)": 11,
+		"!":                1,
+		"":                 0,
+		"A ||| A":          4,
+	}
+	for expr, pos := range expected {
+		_, err := ParseDependencyExpr(controller, A, expr)
+		syntaxErr, ok := err.(ErrExprSyntax)
+		if !ok {
+			t.Fatal("should error", expr)
+		}
+		if syntaxErr.Pos != pos {
+			t.Fatal("Position Error", syntaxErr, pos)
+		}
+		t.Log(err)
+	}
+	if len(A.dependency) != 0 {
+		t.Fatal("Dependency Error", A.dependency)
+	}
+}
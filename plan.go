@@ -0,0 +1,513 @@
+package gotcc
+
+import (
+	"context"
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+// An immutable snapshot of the task graph of a controller. A plan can be run many times,
+// even concurrently, because every run creates its own execution state.
+type Plan struct {
+	executors   map[uint32]*Executor
+	termination *Executor
+
+	sortedId []uint32
+	index    map[uint32]int
+}
+
+// Freeze the task graph into a reusable plan. Modification of the controller after Compile()
+// won't affect the plan. If failed, return the first problem found by Validate, such as
+// ErrNoTermination, ErrLoopDependency or ErrUnsatisfiable.
+func (m *TCController) Compile() (*Plan, error) {
+	if errs := m.Validate(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	taskorder, _ := m.analyzeDependency()
+	sortedId := m.sortExecutor(taskorder)
+
+	p := &Plan{
+		executors:   make(map[uint32]*Executor, len(m.executors)),
+		termination: m.termination.freeze(),
+		sortedId:    sortedId,
+		index:       make(map[uint32]int, len(sortedId)),
+	}
+	for i, taskid := range sortedId {
+		p.index[taskid] = i
+	}
+	for taskid, e := range m.executors {
+		frozen := e.freeze()
+		if e.sub != nil {
+			subPlan, err := e.sub.Compile()
+			if err != nil {
+				return nil, ErrSubController{TaskName: e.name, Err: err}
+			}
+			frozen.subPlan = subPlan
+		}
+		p.executors[taskid] = frozen
+	}
+	return p, nil
+}
+
+// Run the plan. If success, return a map[name]value, where names are task
+// of termination dependent tasks and values are their return value.
+// If failed, return ErrAborted
+func (p *Plan) BatchRun() (map[string]interface{}, error) {
+	return p.BatchRunContext(context.Background())
+}
+
+// Like BatchRun, but `ctx` becomes the parent of args["CANCEL"]. If `ctx` is
+// cancelled or its deadline is exceeded, the execution is aborted and rolled back,
+// and the returned ErrAborted records ctx.Err() as its Cause.
+func (p *Plan) BatchRunContext(ctx context.Context) (map[string]interface{}, error) {
+	return p.batchRun(p.newExecution(ctx, nil))
+}
+
+func (p *Plan) batchRun(r *execution) (map[string]interface{}, error) {
+	return r.schedule(DefaultNoPool{})
+}
+
+// The state of a single run of a plan.
+type execution struct {
+	plan *Plan
+
+	parentCtx  context.Context
+	cancelCtx  context.Context
+	cancelFunc context.CancelFunc
+
+	// only accessed by the scheduler
+	outcomes map[uint32]taskOutcome
+	values   map[uint32]interface{}
+	launched map[uint32]bool
+	running  int
+
+	// tasks spawned at runtime, see Spawner
+	// prefix of the task names in errors and reports, for a sub controller
+	namespace string
+
+	spawned    map[uint32]*Executor
+	spawnOrder []uint32
+	spawnIndex map[uint32]int
+	names      map[string]bool
+	parent     map[uint32]uint32
+	children   map[uint32][]uint32
+	unfinished map[uint32]int
+	// outcome of a task waiting for its children
+	waiting map[uint32]taskOutcome
+
+	messages chan message
+	onResult func(name string, value interface{})
+
+	cancelled cancelList
+	errorMsgs errorLisk
+	undoStack undoStack
+
+	startTime time.Time
+	endTime   time.Time
+	reports   map[uint32]*TaskReport
+}
+
+func (p *Plan) newExecution(ctx context.Context, onResult func(name string, value interface{})) *execution {
+	r := &execution{
+		plan:      p,
+		parentCtx: ctx,
+		outcomes:  make(map[uint32]taskOutcome, len(p.executors)),
+		values:    make(map[uint32]interface{}, len(p.executors)),
+		launched:  make(map[uint32]bool, len(p.executors)),
+		messages:  make(chan message, len(p.executors)),
+		onResult:  onResult,
+		startTime: time.Now(),
+		reports:   make(map[uint32]*TaskReport, len(p.executors)),
+
+		spawned:    map[uint32]*Executor{},
+		parent:     map[uint32]uint32{},
+		children:   map[uint32][]uint32{},
+		unfinished: map[uint32]int{},
+		waiting:    map[uint32]taskOutcome{},
+		spawnIndex: map[uint32]int{},
+		names:      make(map[string]bool, len(p.executors)),
+	}
+	r.cancelCtx, r.cancelFunc = context.WithCancel(ctx)
+	for taskid, e := range p.executors {
+		r.reports[taskid] = &TaskReport{TaskName: e.name}
+		r.names[e.name] = true
+	}
+	return r
+}
+
+// Launch tasks once their dependency expressions are true, and skip them once their
+// dependency expressions are false, until the termination expression is true, some
+// task fails or nothing can be launched anymore.
+func (r *execution) schedule(pool GoroutinePool) (map[string]interface{}, error) {
+	defer func() {
+		r.endTime = time.Now()
+	}()
+
+	t := r.plan.termination
+	candidates := r.plan.sortedId
+	skipped := false
+	for {
+		if r.cancelCtx.Err() != nil {
+			return nil, r.abort()
+		}
+		value, err := r.eval(t)
+		if err != nil {
+			return nil, r.abort()
+		}
+		if value == valueTrue {
+			// all done!
+			r.cancelFunc()
+			r.drain()
+			Results := map[string]interface{}{}
+			for taskid := range t.dependency {
+				if r.outcomes[taskid] == outcomeSucceeded {
+					r.collectValues(taskid, Results)
+				}
+			}
+			return Results, nil
+		}
+		for i := 0; i < len(candidates); i++ {
+			taskid := candidates[i]
+			e := r.executor(taskid)
+			if r.launched[taskid] || r.outcomes[taskid] == outcomeSkipped {
+				continue
+			}
+			value, err := r.eval(e)
+			if err != nil {
+				return nil, r.abort()
+			}
+			switch value {
+			case valueUnknown:
+				continue
+			case valueFalse:
+				// its subscribers may be decided now
+				candidates = r.mergeCandidates(candidates[i+1:], r.skip(e))
+				skipped = true
+				i = -1
+				continue
+			}
+			r.launched[taskid] = true
+			r.running++
+			args := r.newArgs(e)
+			report := r.reports[taskid]
+			if err := pool.Go(func() { r.launch(e, args, report) }); err != nil {
+				// stop the launched tasks
+				r.running--
+				r.cancelFunc()
+				r.drain()
+				return nil, err
+			}
+		}
+		if skipped {
+			// skipping tasks may make the termination true
+			skipped = false
+			if value, err := r.eval(t); err != nil || value == valueTrue {
+				continue
+			}
+		}
+		if r.running == 0 {
+			return nil, r.stall()
+		}
+
+		select {
+		case <-r.cancelCtx.Done():
+			// aborted
+		case msg := <-r.messages:
+			r.running--
+			candidates = r.receive(msg)
+		}
+	}
+}
+
+// Evaluate the dependency expression of `e`. If a value predicate panicked, abort the
+// execution and return ErrPredicatePanic.
+func (r *execution) eval(e *Executor) (value exprValue, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			predicateErr, ok := v.(ErrPredicatePanic)
+			if !ok {
+				panic(v)
+			}
+			value, err = valueUnknown, predicateErr
+			r.errorMsgs.append(newErrorMessage(r.name(e), err))
+			r.cancelFunc()
+		}
+	}()
+	return e.dependencyExpr.eval(r.outcomes, r.values), nil
+}
+
+func (r *execution) newArgs(e *Executor) map[string]interface{} {
+	args := map[string]interface{}{"BIND": e.bindArgs, "CANCEL": r.cancelCtx, "NAME": e.name}
+	for taskid := range e.dependency {
+		if r.outcomes[taskid] == outcomeSucceeded {
+			r.collectValues(taskid, args)
+		}
+	}
+	return args
+}
+
+// Put the result of a succeeded task, and the results of the tasks spawned by it, into `m`.
+func (r *execution) collectValues(taskid uint32, m map[string]interface{}) {
+	m[r.executor(taskid).name] = r.values[taskid]
+	for _, childid := range r.children[taskid] {
+		if r.outcomes[childid] == outcomeSucceeded {
+			r.collectValues(childid, m)
+		}
+	}
+}
+
+// Get the name of a task in errors and reports.
+func (r *execution) name(e *Executor) string {
+	return r.namespace + e.name
+}
+
+// Get a task of the plan, or a task spawned at runtime.
+func (r *execution) executor(taskid uint32) *Executor {
+	if e, exists := r.plan.executors[taskid]; exists {
+		return e
+	}
+	return r.spawned[taskid]
+}
+
+// Get the position of a task in the plan. Spawned tasks are after the tasks of the plan.
+func (r *execution) index(taskid uint32) int {
+	if i, exists := r.plan.index[taskid]; exists {
+		return i
+	}
+	if i, exists := r.spawnIndex[taskid]; exists {
+		return len(r.plan.sortedId) + i
+	}
+	return len(r.plan.sortedId) + len(r.spawnOrder)
+}
+
+// Get the subscribers of `e` in the order of the plan.
+func (r *execution) subscribers(e *Executor) []uint32 {
+	res := make([]uint32, 0, len(e.subscribers))
+	for _, taskid := range e.subscribers {
+		if r.executor(taskid) != nil {
+			res = append(res, taskid)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return r.index(res[i]) < r.index(res[j]) })
+	return res
+}
+
+// Merge two lists of tasks into one, in the order of the plan.
+func (r *execution) mergeCandidates(l1 []uint32, l2 []uint32) []uint32 {
+	res := make([]uint32, 0, len(l1)+len(l2))
+	seen := make(map[uint32]bool, len(l1)+len(l2))
+	for _, l := range [][]uint32{l1, l2} {
+		for _, taskid := range l {
+			if !seen[taskid] {
+				seen[taskid] = true
+				res = append(res, taskid)
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return r.index(res[i]) < r.index(res[j]) })
+	return res
+}
+
+// The dependency expression of `e` became false, so it will never be launched.
+// Return the tasks that may be decided now.
+func (r *execution) skip(e *Executor) []uint32 {
+	r.reports[e.id].Status = TaskSkipped
+	return r.finish(e, outcomeSkipped)
+}
+
+// Set the outcome of `e`. If `e` is the last unfinished child of its parent, the parent
+// finishes too. Return the tasks that may be decided now.
+func (r *execution) finish(e *Executor, outcome taskOutcome) []uint32 {
+	r.outcomes[e.id] = outcome
+	if _, exists := r.plan.termination.dependency[e.id]; exists && outcome == outcomeSucceeded && r.onResult != nil {
+		r.onResult(e.name, r.values[e.id])
+	}
+	candidates := r.subscribers(e)
+
+	parentid, exists := r.parent[e.id]
+	if !exists {
+		return candidates
+	}
+	if outcome == outcomeFailed {
+		r.waiting[parentid] = outcomeFailed
+	}
+	r.unfinished[parentid]--
+	if r.unfinished[parentid] == 0 {
+		candidates = r.mergeCandidates(candidates, r.finish(r.executor(parentid), r.waiting[parentid]))
+	}
+	return candidates
+}
+
+// Handle the message of a finished task. Return the tasks that may be decided now.
+func (r *execution) receive(msg message) []uint32 {
+	e := msg.sender
+	if msg.err != nil {
+		switch err := msg.err.(type) {
+		case ErrSilentFail:
+			r.errorMsgs.append(newTaskErrorMessage(r.name(e), err, msg.attemptErrors))
+		case ErrCancelled:
+			r.cancelled.append(newStateMessage(r.name(e), err.State))
+		default:
+			r.errorMsgs.append(newTaskErrorMessage(r.name(e), err, msg.attemptErrors))
+			r.cancelFunc()
+		}
+		return r.finish(e, outcomeFailed)
+	}
+
+	r.values[e.id] = msg.value
+	// add to finished stack...
+	undo := e.undo
+	if e.subPlan != nil {
+		undo = subControllerUndo(e.undo)
+	}
+	r.undoStack.push(newUndoFunc(r.name(e), e.undoSkipError, undo, msg.args, r.reports[e.id]))
+	if len(msg.spawned) == 0 {
+		return r.finish(e, outcomeSucceeded)
+	}
+	if err := r.checkSpawned(msg.spawned); err != nil {
+		r.errorMsgs.append(newErrorMessage(r.name(e), err))
+		r.cancelFunc()
+		return r.finish(e, outcomeFailed)
+	}
+
+	// wait for the children
+	candidates := make([]uint32, 0, len(msg.spawned))
+	for _, child := range msg.spawned {
+		r.spawned[child.id] = child
+		r.spawnIndex[child.id] = len(r.spawnOrder)
+		r.spawnOrder = append(r.spawnOrder, child.id)
+		r.names[child.name] = true
+		r.reports[child.id] = &TaskReport{TaskName: r.name(child)}
+		r.parent[child.id] = e.id
+		r.children[e.id] = append(r.children[e.id], child.id)
+		candidates = append(candidates, child.id)
+	}
+	r.unfinished[e.id] = len(msg.spawned)
+	r.waiting[e.id] = outcomeSucceeded
+	return candidates
+}
+
+// Wait for all running tasks.
+func (r *execution) drain() {
+	for r.running > 0 {
+		r.receive(<-r.messages)
+		r.running--
+	}
+}
+
+// Aborted because of some error.
+func (r *execution) abort() error {
+	r.drain()
+	returnErr := ErrAborted{
+		TaskErrors: r.errorMsgs.items,
+		Cancelled:  r.cancelled.items,
+		Cause:      r.parentCtx.Err(),
+	}
+
+	// do the rollback
+	returnErr.UndoErrors = r.undoStack.undoAll(&r.errorMsgs, &r.cancelled).items
+	return returnErr
+}
+
+// Nothing is running and nothing can be launched, but the termination expression is false.
+func (r *execution) stall() error {
+	r.cancelFunc()
+	returnErr := ErrStalled{
+		Termination: r.plan.termination.dependencyExpr,
+		TaskErrors:  r.errorMsgs.items,
+	}
+	for _, taskid := range append(append([]uint32{}, r.plan.sortedId...), r.spawnOrder...) {
+		if !r.launched[taskid] && r.outcomes[taskid] == outcomePending {
+			e := r.executor(taskid)
+			returnErr.Pending = append(returnErr.Pending, &PendingTask{TaskName: r.name(e), Dependency: e.dependencyExpr})
+		}
+	}
+
+	// do the rollback
+	returnErr.UndoErrors = r.undoStack.undoAll(&r.errorMsgs, &r.cancelled).items
+	return returnErr
+}
+
+func (r *execution) launch(e *Executor, args map[string]interface{}, report *TaskReport) {
+	report.start()
+	args, result, attemptErrors, err := r.retryTask(e, args)
+	report.finish(result, err)
+	msg := message{
+		sender:        e,
+		args:          args,
+		value:         result,
+		err:           err,
+		attemptErrors: attemptErrors,
+	}
+	if spawner, ok := args["SPAWN"].(*Spawner); ok && err == nil {
+		msg.spawned = spawner.spawned()
+	}
+	select {
+	case r.messages <- msg:
+	default:
+		// spawned tasks may fill the buffer, so don't block the worker of the pool
+		go func() { r.messages <- msg }()
+	}
+}
+
+// Get the outcome of every task. It should be called after the run finished.
+func (r *execution) report() *RunReport {
+	rr := &RunReport{
+		StartTime: r.startTime,
+		EndTime:   r.endTime,
+		Tasks:     make([]*TaskReport, 0, len(r.plan.sortedId)),
+	}
+	for _, taskid := range r.plan.sortedId {
+		rr.Tasks = append(rr.Tasks, r.reports[taskid])
+	}
+	for _, taskid := range r.spawnOrder {
+		rr.Tasks = append(rr.Tasks, r.reports[taskid])
+	}
+	return rr
+}
+
+type taskReturn struct {
+	value interface{}
+	err   error
+}
+
+func (r *execution) runTask(e *Executor, args map[string]interface{}) (interface{}, error) {
+	if e.timeout <= 0 {
+		return callTask(r.taskFunc(e), args)
+	}
+
+	ctx, cancel := context.WithTimeout(r.cancelCtx, e.timeout)
+	defer cancel()
+	args["CANCEL"] = ctx
+
+	// the task may never return, so don't let it block the controller
+	done := make(chan taskReturn, 1)
+	go func() {
+		value, err := callTask(r.taskFunc(e), args)
+		done <- taskReturn{value, err}
+	}()
+
+	timer := time.NewTimer(e.timeout)
+	defer timer.Stop()
+	select {
+	case ret := <-done:
+		if ret.err != nil && ctx.Err() == context.DeadlineExceeded && r.cancelCtx.Err() == nil {
+			// the task gave up because of its own deadline
+			return nil, ErrTaskTimeout{Timeout: e.timeout}
+		}
+		return ret.value, ret.err
+	case <-timer.C:
+		return nil, ErrTaskTimeout{Timeout: e.timeout}
+	}
+}
+
+// Call the task function, and convert its panic into ErrTaskPanic.
+func callTask(f func(args map[string]interface{}) (interface{}, error), args map[string]interface{}) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			value, err = nil, ErrTaskPanic{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return f(args)
+}
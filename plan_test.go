@@ -0,0 +1,63 @@
+package gotcc
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestPlanConcurrentRun(t *testing.T) {
+	controller := NewTCController()
+	A := controller.AddTask("A", TaskDefault, 1)
+	B := controller.AddTask("B", TaskDefault, 2)
+	C := controller.AddTask("C", TaskDefault, 3)
+	D := controller.AddTask("D", TaskDefault, 4)
+	E := controller.AddTask("E", TaskDefault, 5)
+	F := controller.AddTask("F", TaskDefault, 6)
+
+	C.SetDependency(MakeAndExpr(C.NewDependencyExpr(A), C.NewDependencyExpr(B))) // 3 + 1 + 2 = 6
+	D.SetDependency(D.NewDependencyExpr(C))                                      // 4 + 6 = 10
+	E.SetDependency(MakeAndExpr(E.NewDependencyExpr(B), E.NewDependencyExpr(C))) // 5 + 2 + 6 = 13
+	F.SetDependency(MakeAndExpr(F.NewDependencyExpr(D), F.NewDependencyExpr(E))) // 6 + 10 + 13 = 29
+
+	controller.SetTermination(controller.NewTerminationExpr(F))
+
+	plan, err := controller.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// modification of the controller won't affect the plan
+	G := controller.AddTask("G", TaskMustFail, 7)
+	F.SetDependency(MakeAndExpr(F.DependencyExpr(), F.NewDependencyExpr(G)))
+
+	pool := NewDefaultPool(4)
+	defer pool.Close()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			res, err := plan.BatchRun()
+			if err != nil {
+				t.Error(err)
+			} else if sum := res["F"]; sum != 29 {
+				t.Error("Sum Error", sum)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			res, err := plan.PoolRun(pool)
+			if err != nil {
+				t.Error(err)
+			} else if sum := res["F"]; sum != 29 {
+				t.Error("Sum Error", sum)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := controller.BatchRun(); err == nil {
+		t.Fatal("Task not fail!")
+	}
+}
@@ -1,87 +1,47 @@
 package gotcc
 
 import (
-	"sync"
+	"context"
 
 	"github.com/panjf2000/ants/v2"
 )
 
 // Goroutine pool interface. It should be blocked until worker available.
+// A task is submitted only when its dependency expression is true, so it never waits inside the pool.
 type GoroutinePool interface {
 	Go(task func()) error
 }
 
 // Run the execution with a Coroutine Pool. If success, return a map[name]value, where names are task
 // of termination dependent tasks and values are their return value.
-// If failed, return ErrNoTermination, ErrLoopDependency or ErrAborted
+// If failed, return the first problem found by Validate, or ErrAborted
 func (m *TCController) PoolRun(pool GoroutinePool) (map[string]interface{}, error) {
-	if len(m.termination.dependency) == 0 {
-		return nil, ErrNoTermination{}
-	}
-	taskorder, noloop := m.analyzeDependency()
-	if !noloop {
-		return nil, ErrLoopDependency{}
-	}
-	sortedId, canSort := m.sortExecutor(taskorder)
-	if !canSort {
-		return nil, ErrPoolUnsupport{}
-	}
-
-	defer m.reset()
+	return m.PoolRunContext(context.Background(), pool)
+}
 
-	wg := sync.WaitGroup{}
-lauchLoop:
-	for _, taskid := range sortedId {
-		e := m.executors[taskid]
-		wg.Add(1)
-		err := pool.Go(func() {
-			m.launch(e, &wg)
-		})
-		if err != nil {
-			return nil, err
-		}
-		select {
-		case <-m.cancelCtx.Done():
-			break lauchLoop
-		default:
-		}
+// Like PoolRun, but `ctx` becomes the parent of args["CANCEL"]. If `ctx` is
+// cancelled or its deadline is exceeded, the execution is aborted and rolled back,
+// and the returned ErrAborted records ctx.Err() as its Cause.
+func (m *TCController) PoolRunContext(ctx context.Context, pool GoroutinePool) (map[string]interface{}, error) {
+	plan, err := m.Compile()
+	if err != nil {
+		return nil, err
 	}
+	return plan.PoolRunContext(ctx, pool)
+}
 
-	// wait termination
-	t := m.termination
-	Results := map[string]interface{}{}
-	Aborted := false
-
-waitLoop:
-	for !t.dependencyExpr.f() {
-		select {
-		case <-m.cancelCtx.Done():
-			// aborted
-			Aborted = true
-			break waitLoop
-		case msg := <-t.messageBuffer:
-			t.markDependency(msg.senderId, true)
-			Results[msg.senderName] = msg.value
-		}
-	}
-	if !Aborted {
-		// all done!
-		m.cancelFunc()
-		wg.Wait()
-		return Results, nil
-	} else {
-		// aborted because of some error
-		wg.Wait()
-		returnErr := ErrAborted{
-			TaskErrors: m.errorMsgs.items,
-			Cancelled:  m.cancelled.items,
-		}
+// Run the plan with a Coroutine Pool. If success, return a map[name]value, where names are task
+// of termination dependent tasks and values are their return value.
+// If failed, return ErrAborted
+func (p *Plan) PoolRun(pool GoroutinePool) (map[string]interface{}, error) {
+	return p.PoolRunContext(context.Background(), pool)
+}
 
-		// do the rollback
-		returnErr.UndoErrors = m.undoStack.undoAll(&m.errorMsgs, &m.cancelled).items
-		// fmt.Println(returnErr.Error())
-		return nil, returnErr
-	}
+// Like PoolRun, but `ctx` becomes the parent of args["CANCEL"]. If `ctx` is
+// cancelled or its deadline is exceeded, the execution is aborted and rolled back,
+// and the returned ErrAborted records ctx.Err() as its Cause.
+func (p *Plan) PoolRunContext(ctx context.Context, pool GoroutinePool) (map[string]interface{}, error) {
+	return p.newExecution(ctx, nil).schedule(pool)
 }
 
 // Default coroutine pool: actually not a coroutine pool but only launch new goroutines.
@@ -0,0 +1,156 @@
+package gotcc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Status of a task in a run.
+type TaskStatus int
+
+const (
+	TaskNotLaunched TaskStatus = iota
+	TaskSucceeded
+	TaskFailed
+	TaskSilentFailed
+	TaskCancelled
+	TaskUndone
+	TaskSkipped
+)
+
+func (s TaskStatus) String() string {
+	switch s {
+	case TaskNotLaunched:
+		return "not launched"
+	case TaskSucceeded:
+		return "succeeded"
+	case TaskFailed:
+		return "failed"
+	case TaskSilentFailed:
+		return "silently failed"
+	case TaskCancelled:
+		return "cancelled"
+	case TaskUndone:
+		return "undone"
+	case TaskSkipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+// Outcome of a task in a run. StartTime, EndTime and Duration are zero if the task
+// has never been launched. UndoError is the error of its undo function, if any.
+type TaskReport struct {
+	TaskName  string
+	Status    TaskStatus
+	StartTime time.Time
+	EndTime   time.Time
+	Duration  time.Duration
+	Result    interface{}
+	Error     error
+	UndoError error
+}
+
+func (tr *TaskReport) start() {
+	tr.StartTime = time.Now()
+}
+
+func (tr *TaskReport) finish(result interface{}, err error) {
+	tr.EndTime = time.Now()
+	tr.Duration = tr.EndTime.Sub(tr.StartTime)
+	tr.Result = result
+	tr.Error = err
+	switch err.(type) {
+	case nil:
+		tr.Status = TaskSucceeded
+	case ErrSilentFail:
+		tr.Status = TaskSilentFailed
+	case ErrCancelled:
+		tr.Status = TaskCancelled
+	default:
+		tr.Status = TaskFailed
+	}
+}
+
+func (tr *TaskReport) undone(err error) {
+	if err != nil {
+		tr.UndoError = err
+	} else {
+		tr.Status = TaskUndone
+	}
+}
+
+// Outcome of every task in a run, in the order of dependency levels and then task names.
+type RunReport struct {
+	StartTime time.Time
+	EndTime   time.Time
+	Tasks     []*TaskReport
+}
+
+// Get the report of task `name`. Return nil if it doesn't exist.
+func (rr *RunReport) Task(name string) *TaskReport {
+	for _, tr := range rr.Tasks {
+		if tr.TaskName == name {
+			return tr
+		}
+	}
+	return nil
+}
+
+func (rr *RunReport) String() string {
+	var sb strings.Builder
+	for _, tr := range rr.Tasks {
+		sb.WriteString(tr.TaskName)
+		sb.WriteString(": ")
+		sb.WriteString(tr.Status.String())
+		if tr.Status != TaskNotLaunched {
+			sb.WriteString(fmt.Sprintf(" in %v", tr.Duration))
+		}
+		if tr.Error != nil {
+			sb.WriteString(", ")
+			sb.WriteString(tr.Error.Error())
+		}
+		if tr.UndoError != nil {
+			sb.WriteString(", undo: ")
+			sb.WriteString(tr.UndoError.Error())
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// Run the execution like BatchRunContext, and also return the outcome of every task of the
+// run, so that the intermediate tasks can be inspected without Start(). The report is nil
+// if the controller failed to compile.
+func (m *TCController) Run(ctx context.Context) (*RunReport, map[string]interface{}, error) {
+	plan, err := m.Compile()
+	if err != nil {
+		return nil, nil, err
+	}
+	return plan.Run(ctx)
+}
+
+// Like Run, but with a Coroutine Pool, like PoolRunContext.
+func (m *TCController) RunPool(ctx context.Context, pool GoroutinePool) (*RunReport, map[string]interface{}, error) {
+	plan, err := m.Compile()
+	if err != nil {
+		return nil, nil, err
+	}
+	return plan.RunPool(ctx, pool)
+}
+
+// Run the plan like BatchRunContext, and also return the outcome of every task of the run.
+func (p *Plan) Run(ctx context.Context) (*RunReport, map[string]interface{}, error) {
+	r := p.newExecution(ctx, nil)
+	Results, err := p.batchRun(r)
+	return r.report(), Results, err
+}
+
+// Like Run, but with a Coroutine Pool, like PoolRunContext.
+func (p *Plan) RunPool(ctx context.Context, pool GoroutinePool) (*RunReport, map[string]interface{}, error) {
+	r := p.newExecution(ctx, nil)
+	Results, err := r.schedule(pool)
+	return r.report(), Results, err
+}
@@ -0,0 +1,96 @@
+package gotcc
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff returns how long to wait before the next attempt, after `attempt` attempts failed.
+type Backoff func(attempt int) time.Duration
+
+// Wait the same duration `d` before each retry.
+func ConstantBackoff(d time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		return d
+	}
+}
+
+// Wait `base`, 2*`base`, 4*`base`... before each retry, but never longer than `max`.
+// `base` <= 0 means no waiting.
+func ExponentialBackoff(base time.Duration, max time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		if base <= 0 {
+			return 0
+		}
+		d := base
+		for i := 1; i < attempt && d < max; i++ {
+			d *= 2
+			if d <= 0 {
+				// overflow
+				return max
+			}
+		}
+		if d > max {
+			return max
+		}
+		return d
+	}
+}
+
+// Like ExponentialBackoff, but wait a random duration between 0 and the exponential one,
+// so that retries of many tasks won't happen at the same time.
+func JitterBackoff(base time.Duration, max time.Duration) Backoff {
+	exponential := ExponentialBackoff(base, max)
+	return func(attempt int) time.Duration {
+		d := exponential(attempt)
+		if d <= 0 {
+			return 0
+		}
+		return time.Duration(rand.Int63n(int64(d) + 1))
+	}
+}
+
+// Default retry predicate: retry every error except ErrSilentFail, ErrCancelled, ErrTaskPanic
+// and ErrInputType.
+var DefaultRetryable = func(err error) bool {
+	switch err.(type) {
+	case ErrSilentFail, ErrCancelled, ErrTaskPanic, ErrInputType:
+		return false
+	}
+	return true
+}
+
+// Call the task function until it succeeds, the error is not retryable, or the attempts are
+// used up. Return the args and the result of the last attempt, and errors of all failed attempts.
+func (r *execution) retryTask(e *Executor, args map[string]interface{}) (map[string]interface{}, interface{}, []error, error) {
+	var attemptErrors []error
+	for attempt := 1; ; attempt++ {
+		// every attempt has its own args, because a timed out attempt may be still running
+		attemptArgs := make(map[string]interface{}, len(args)+2)
+		for k, v := range args {
+			attemptArgs[k] = v
+		}
+		if e.retryAttempts > 0 {
+			attemptArgs["ATTEMPT"] = attempt
+		}
+		// so are the tasks spawned by each attempt
+		attemptArgs["SPAWN"] = newSpawner(e)
+		result, err := r.runTask(e, attemptArgs)
+		if err == nil {
+			return attemptArgs, result, attemptErrors, nil
+		}
+		attemptErrors = append(attemptErrors, err)
+		if attempt >= e.retryAttempts || !e.retryable(err) {
+			return attemptArgs, nil, attemptErrors, err
+		}
+
+		timer := time.NewTimer(e.retryBackoff(attempt))
+		select {
+		case <-r.cancelCtx.Done():
+			// no more attempts once the execution is aborted
+			timer.Stop()
+			return attemptArgs, nil, attemptErrors, err
+		case <-timer.C:
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package gotcc
 
-import "sync"
+import (
+	"runtime/debug"
+	"sync"
+)
 
 type undoStack struct {
 	lock  sync.Mutex
@@ -14,14 +17,17 @@ type undoFunc struct {
 
 	args map[string]interface{}
 	f    func(map[string]interface{}) error
+
+	report *TaskReport
 }
 
-func newUndoFunc(name string, skipError bool, undo func(args map[string]interface{}) error, args map[string]interface{}) *undoFunc {
+func newUndoFunc(name string, skipError bool, undo func(args map[string]interface{}) error, args map[string]interface{}, report *TaskReport) *undoFunc {
 	return &undoFunc{
 		name:      name,
 		skipError: skipError,
 		args:      args,
 		f:         undo,
+		report:    report,
 	}
 }
 
@@ -31,12 +37,6 @@ func (u *undoStack) push(uf *undoFunc) {
 	u.lock.Unlock()
 }
 
-func (u *undoStack) reset() {
-	u.lock.Lock()
-	u.items = []*undoFunc{}
-	u.lock.Unlock()
-}
-
 func (u *undoStack) undoAll(taskErrors *errorLisk, cancelled *cancelList) *errorLisk {
 	undoErrors := &errorLisk{}
 	for i := len(u.items) - 1; i >= 0; i-- {
@@ -44,7 +44,8 @@ func (u *undoStack) undoAll(taskErrors *errorLisk, cancelled *cancelList) *error
 		u.items[i].args["UNDOERR"] = undoErrors.items
 		u.items[i].args["CANCELLED"] = cancelled.items
 
-		err := u.items[i].f(u.items[i].args)
+		err := callUndo(u.items[i].f, u.items[i].args)
+		u.items[i].report.undone(err)
 		if err != nil {
 			undoErrors.append(newErrorMessage(u.items[i].name, err))
 			if !u.items[i].skipError {
@@ -55,6 +56,16 @@ func (u *undoStack) undoAll(taskErrors *errorLisk, cancelled *cancelList) *error
 	return undoErrors
 }
 
+// Call the undo function, and convert its panic into ErrUndoPanic.
+func callUndo(f func(map[string]interface{}) error, args map[string]interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrUndoPanic{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return f(args)
+}
+
 // Default undo function
 var EmptyUndoFunc = func(args map[string]interface{}) error {
 	return nil
@@ -0,0 +1,310 @@
+package gotcc
+
+import "sort"
+
+// Max number of assignments to enumerate for the tasks referenced more than once in an
+// expression. If there are more, the expression is assumed to be satisfiable.
+const maxSatAssignments = 1 << 16
+
+// Check that every dependency expression and the termination expression can be true
+// given the graph. Once a task finished or was skipped, the value of an expression
+// depending on it won't change, so only the final outcomes of tasks are considered.
+func (m *TCController) checkSatisfiable(sortedId []uint32) error {
+	c := &satChecker{
+		executors: m.executors,
+		domains:   make(map[uint32][]taskOutcome, len(sortedId)),
+		position:  make(map[uint32]int, len(sortedId)),
+		fanout:    make(map[uint32]bool, len(sortedId)),
+	}
+	for i, taskid := range sortedId {
+		e := m.executors[taskid]
+		if sub, ok := c.satisfiable(e.dependencyExpr); !ok {
+			return ErrUnsatisfiable{TaskName: e.name, Expr: e.dependencyExpr, SubExpr: sub}
+		}
+		c.domains[taskid] = []taskOutcome{outcomeSucceeded, outcomeFailed}
+		if canFalse, _ := c.possible(e.dependencyExpr); canFalse {
+			c.domains[taskid] = append(c.domains[taskid], outcomeSkipped)
+		}
+		c.position[taskid] = i
+		c.fanout[taskid] = len(e.subscribers) > 1
+		for depid := range e.dependency {
+			c.fanout[taskid] = c.fanout[taskid] || c.fanout[depid]
+		}
+	}
+	if sub, ok := c.satisfiable(m.termination.dependencyExpr); !ok {
+		return ErrUnsatisfiable{Termination: true, Expr: m.termination.dependencyExpr, SubExpr: sub}
+	}
+	return nil
+}
+
+// The tasks checked so far, their possible outcomes and their positions in topological order.
+// fanout: whether the task or any of its ancestors has more than one subscriber. If none of
+// the tasks referenced by an expression does, they have no ancestor in common.
+type satChecker struct {
+	executors map[uint32]*Executor
+	domains   map[uint32][]taskOutcome
+	position  map[uint32]int
+	fanout    map[uint32]bool
+}
+
+// Whether `Expr` can be true given the graph. If not, return the smallest sub-expression
+// that can never be true.
+func (c *satChecker) satisfiable(Expr DependencyExpression) (DependencyExpression, bool) {
+	if _, canTrue := c.possible(Expr); canTrue {
+		return Expr, true
+	}
+	// find the culprit
+	for {
+		var next *DependencyExpression
+		switch Expr.kind {
+		case ExprAnd:
+			for i := range Expr.operands {
+				if _, canTrue := c.possible(Expr.operands[i]); !canTrue {
+					next = &Expr.operands[i]
+					break
+				}
+			}
+		}
+		if next == nil {
+			return Expr, false
+		}
+		Expr = *next
+	}
+}
+
+// Whether `Expr` can be false and whether it can be true given the graph. The outcomes of
+// tasks are not independent: a task is launched only if its dependency expression is true,
+// and skipped only if it is false. For example, `D && !A` can never be true if D depends
+// on A. So enumerate the joint outcomes of the tasks referenced by `Expr`, and of their
+// ancestors which are shared by more than one of them or depend on a shared one. If there
+// are too many, fall back to treating them as independent.
+func (c *satChecker) possible(Expr DependencyExpression) (canFalse bool, canTrue bool) {
+	canFalse, canTrue = possible(Expr, c.domains)
+	if !canFalse && !canTrue {
+		return false, false
+	}
+	fanout := false
+	Expr.Walk(func(node DependencyExpression) bool {
+		fanout = fanout || node.kind == ExprLeaf && c.fanout[node.task.id]
+		return !fanout
+	})
+	if !fanout {
+		return canFalse, canTrue
+	}
+	referenced := map[uint32]bool{}
+	for _, d := range Expr.Executors() {
+		if _, exists := c.domains[d.id]; exists {
+			referenced[d.id] = true
+		}
+	}
+	if len(referenced) < 2 {
+		return canFalse, canTrue
+	}
+
+	// the ancestors reached from more than one referenced task are shared.
+	// Every task is visited at most twice.
+	owner := map[uint32]uint32{}
+	shared := map[uint32]bool{}
+	var visit func(taskid uint32, from uint32)
+	visit = func(taskid uint32, from uint32) {
+		if shared[taskid] {
+			return
+		}
+		if o, exists := owner[taskid]; !exists {
+			owner[taskid] = from
+		} else if o == from {
+			return
+		} else {
+			shared[taskid] = true
+		}
+		for depid := range c.executors[taskid].dependency {
+			if _, exists := c.domains[depid]; exists {
+				visit(depid, from)
+			}
+		}
+	}
+	for taskid := range referenced {
+		visit(taskid, taskid)
+	}
+	if len(shared) == 0 {
+		// independent
+		return canFalse, canTrue
+	}
+
+	// the tasks to enumerate in topological order. The others are independent.
+	closure := make([]uint32, 0, len(owner))
+	for taskid := range owner {
+		closure = append(closure, taskid)
+	}
+	sort.Slice(closure, func(i, j int) bool {
+		return c.position[closure[i]] < c.position[closure[j]]
+	})
+	dependent := make(map[uint32]bool, len(closure))
+	ancestors := []uint32{}
+	for _, taskid := range closure {
+		dependent[taskid] = shared[taskid]
+		for depid := range c.executors[taskid].dependency {
+			dependent[taskid] = dependent[taskid] || dependent[depid]
+		}
+		if dependent[taskid] || referenced[taskid] {
+			ancestors = append(ancestors, taskid)
+		}
+	}
+
+	jointFalse, jointTrue := false, false
+	steps := 0
+	fixed := make(map[uint32]taskOutcome, len(ancestors))
+	var enumerate func(i int) bool
+	enumerate = func(i int) bool {
+		if steps++; steps > maxSatAssignments {
+			return false
+		}
+		if jointFalse == canFalse && jointTrue == canTrue {
+			return true
+		}
+		if i == len(ancestors) {
+			f, t := possibleValues(Expr, fixed, c.domains)
+			jointFalse = jointFalse || f
+			jointTrue = jointTrue || t
+			return true
+		}
+		taskid := ancestors[i]
+		// the enumerated dependencies of the task come before it, so they are fixed already
+		skippable, launchable := possibleValues(c.executors[taskid].dependencyExpr, fixed, c.domains)
+		for _, outcome := range c.domains[taskid] {
+			if outcome == outcomeSkipped && !skippable || outcome != outcomeSkipped && !launchable {
+				continue
+			}
+			fixed[taskid] = outcome
+			if !enumerate(i + 1) {
+				return false
+			}
+		}
+		delete(fixed, taskid)
+		return true
+	}
+	if !enumerate(0) {
+		return canFalse, canTrue
+	}
+	return jointFalse, jointTrue
+}
+
+// Whether `Expr` can be false and whether it can be true, when the outcomes of different
+// tasks are independent.
+func possible(Expr DependencyExpression, domains map[uint32][]taskOutcome) (canFalse bool, canTrue bool) {
+	// Tasks referenced only once are independent from each other, but the ones referenced
+	// more than once (such as A && !A) are not, so enumerate their outcomes.
+	occurrences := map[uint32]int{}
+	repeated := []uint32{}
+	Expr.Walk(func(node DependencyExpression) bool {
+		if node.kind == ExprLeaf {
+			occurrences[node.task.id]++
+			if occurrences[node.task.id] == 2 && len(domainOf(node.task.id, domains)) > 1 {
+				repeated = append(repeated, node.task.id)
+			}
+		}
+		return true
+	})
+	assignments := 1
+	for _, taskid := range repeated {
+		assignments *= len(domainOf(taskid, domains))
+		if assignments > maxSatAssignments {
+			return true, true
+		}
+	}
+
+	fixed := make(map[uint32]taskOutcome, len(repeated))
+	var enumerate func(i int)
+	enumerate = func(i int) {
+		if canFalse && canTrue {
+			return
+		}
+		if i == len(repeated) {
+			f, t := possibleValues(Expr, fixed, domains)
+			canFalse = canFalse || f
+			canTrue = canTrue || t
+			return
+		}
+		for _, outcome := range domainOf(repeated[i], domains) {
+			fixed[repeated[i]] = outcome
+			enumerate(i + 1)
+		}
+	}
+	enumerate(0)
+	return canFalse, canTrue
+}
+
+// A task out of the graph is always pending.
+func domainOf(taskid uint32, domains map[uint32][]taskOutcome) []taskOutcome {
+	if domain, exists := domains[taskid]; exists {
+		return domain
+	}
+	return []taskOutcome{outcomePending}
+}
+
+// Whether `Expr` can be false and whether it can be true, when the outcomes of the tasks
+// in `fixed` are known, and the other tasks are referenced only once. Neither of them
+// if it is always unknown.
+func possibleValues(Expr DependencyExpression, fixed map[uint32]taskOutcome, domains map[uint32][]taskOutcome) (canFalse bool, canTrue bool) {
+	switch Expr.kind {
+	case ExprTrue:
+		return false, true
+	case ExprFalse:
+		return true, false
+	case ExprLeaf:
+		outcomes := domainOf(Expr.task.id, domains)
+		if outcome, exists := fixed[Expr.task.id]; exists {
+			outcomes = []taskOutcome{outcome}
+		}
+		for _, outcome := range outcomes {
+			if Expr.condition == LeafValue && outcome == outcomeSucceeded {
+				// the predicate may be true or false
+				canFalse, canTrue = true, true
+				continue
+			}
+			switch Expr.eval(map[uint32]taskOutcome{Expr.task.id: outcome}, nil) {
+			case valueTrue:
+				canTrue = true
+			case valueFalse:
+				canFalse = true
+			}
+		}
+		return canFalse, canTrue
+	case ExprNot:
+		canFalse, canTrue = possibleValues(Expr.operands[0], fixed, domains)
+		return canTrue, canFalse
+	case ExprAnd:
+		canTrue = true
+		for _, operand := range Expr.operands {
+			f, t := possibleValues(operand, fixed, domains)
+			canFalse = canFalse || f
+			canTrue = canTrue && t
+		}
+		return canFalse, canTrue
+	case ExprOr:
+		canFalse = true
+		for _, operand := range Expr.operands {
+			f, t := possibleValues(operand, fixed, domains)
+			canFalse = canFalse && f
+			canTrue = canTrue || t
+		}
+		return canFalse, canTrue
+	case ExprXor:
+		f1, t1 := possibleValues(Expr.operands[0], fixed, domains)
+		f2, t2 := possibleValues(Expr.operands[1], fixed, domains)
+		return (f1 && f2) || (t1 && t2), (t1 && f2) || (f1 && t2)
+	case ExprAtLeast:
+		countTrue, countFalse := 0, 0
+		for _, operand := range Expr.operands {
+			f, t := possibleValues(operand, fixed, domains)
+			if t {
+				countTrue++
+			}
+			if f {
+				countFalse++
+			}
+		}
+		return countFalse > len(Expr.operands)-Expr.threshold, countTrue >= Expr.threshold
+	}
+	return true, false
+}
@@ -0,0 +1,73 @@
+package gotcc
+
+import "sync"
+
+// Spawner adds child tasks at runtime, for example, one task per shard. A task gets
+// its spawner from args["SPAWN"].
+//
+// The children are launched after the spawning task succeeded, once their dependency
+// expressions are true. They join the cancellation, the results and the undo stack of
+// the execution. The spawning task is regarded as finished only after all of its children
+// finished, and as failed if any of them failed, so its subscribers and the termination
+// wait for them. The results of the children are passed along with the result of the
+// spawning task.
+type Spawner struct {
+	lock     sync.Mutex
+	parent   *Executor
+	children []*Executor
+}
+
+func newSpawner(parent *Executor) *Spawner {
+	return &Spawner{parent: parent}
+}
+
+// Add a child task. `name`, `f` and `args` are the same as TCController.AddTask.
+// A child may only depend on the other children of the same spawner, and its name must
+// be unique in the execution.
+func (s *Spawner) AddTask(name string, f func(args map[string]interface{}) (interface{}, error), args interface{}) *Executor {
+	e := newExecutor(name, f, args)
+	e.spawner = s
+	s.lock.Lock()
+	s.children = append(s.children, e)
+	s.lock.Unlock()
+	return e
+}
+
+// Get the name of the spawning task.
+func (s *Spawner) Parent() string {
+	return s.parent.name
+}
+
+func (s *Spawner) spawned() []*Executor {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*Executor{}, s.children...)
+}
+
+// Check that the children only depend on each other, and their names collide with neither
+// each other nor the other tasks of the execution.
+func (r *execution) checkSpawned(children []*Executor) error {
+	siblings := make(map[uint32]bool, len(children))
+	count := make(map[string]int, len(children))
+	for _, child := range children {
+		siblings[child.id] = true
+		count[child.name]++
+	}
+	for _, child := range children {
+		if reservedNames[child.name] {
+			return ErrReservedName{TaskName: child.name}
+		}
+		if r.names[child.name] {
+			return ErrDuplicateName{TaskName: child.name, Count: count[child.name] + 1}
+		}
+		if count[child.name] > 1 {
+			return ErrDuplicateName{TaskName: child.name, Count: count[child.name]}
+		}
+		for _, dep := range child.dependencyExpr.Executors() {
+			if !siblings[dep.id] {
+				return ErrInvalidSpawn{TaskName: child.name, Dependency: dep.name}
+			}
+		}
+	}
+	return nil
+}
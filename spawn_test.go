@@ -0,0 +1,155 @@
+package gotcc
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TaskListShards(args map[string]interface{}) (interface{}, error) {
+	spawner := args["SPAWN"].(*Spawner)
+	for i := 1; i <= args["BIND"].(int); i++ {
+		spawner.AddTask("shard"+strconv.Itoa(i), TaskDefault, i)
+	}
+	return 0, nil
+}
+
+func TestSpawn(t *testing.T) {
+	controller := NewTCController()
+	list := controller.AddTask("list", TaskListShards, 50)
+	merge := controller.AddTask("merge", TaskDefault, 0)
+	merge.SetDependency(merge.NewDependencyExpr(list))
+	controller.SetTermination(controller.NewTerminationExpr(merge))
+
+	pool := NewDefaultPool(2)
+	defer pool.Close()
+	for _, h := range []*RunHandle{controller.Start(), controller.StartPool(pool)} {
+		res, err := h.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 1 + 2 + ... + 50
+		if res["merge"] != 1275 {
+			t.Fatal("Result Error", res)
+		}
+		report := h.Report()
+		if len(report.Tasks) != 52 || report.Task("shard50").Status != TaskSucceeded {
+			t.Fatal("Report Error", report)
+		}
+	}
+
+	// the results of the children of termination dependent tasks
+	controller.SetTermination(controller.NewTerminationExpr(list))
+	res, err := controller.BatchRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 51 || res["shard3"] != 3 {
+		t.Fatal("Result Error", res)
+	}
+}
+
+func TestSpawnDependency(t *testing.T) {
+	order := []string{}
+	record := func(args map[string]interface{}) (interface{}, error) {
+		order = append(order, args["NAME"].(string))
+		return nil, nil
+	}
+	controller := NewTCController()
+	build := controller.AddTask("build", func(args map[string]interface{}) (interface{}, error) {
+		spawner := args["SPAWN"].(*Spawner)
+		compile := spawner.AddTask("compile", record, nil)
+		link := spawner.AddTask("link", TaskHang, 10)
+		link.SetDependency(link.NewDependencyExpr(compile))
+		return nil, nil
+	}, nil)
+	deploy := controller.AddTask("deploy", record, nil)
+	deploy.SetDependency(deploy.NewDependencyExpr(build))
+	controller.SetTermination(controller.NewTerminationExpr(deploy))
+
+	h := controller.Start()
+	if _, err := h.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	// deploy waits for the children of build
+	if len(order) != 2 || order[0] != "compile" || order[1] != "deploy" {
+		t.Fatal("Order Error", order)
+	}
+	if h.Report().Task("deploy").StartTime.Before(h.Report().Task("link").EndTime) {
+		t.Fatal("Report Error", h.Report())
+	}
+}
+
+func TestSpawnFailure(t *testing.T) {
+	var undone int32
+	undo := func(args map[string]interface{}) error {
+		atomic.AddInt32(&undone, 1)
+		return nil
+	}
+	controller := NewTCController()
+	parent := controller.AddTask("parent", func(args map[string]interface{}) (interface{}, error) {
+		spawner := args["SPAWN"].(*Spawner)
+		spawner.AddTask("ok", TaskDefault, 1).SetUndoFunc(undo, false)
+		bad := spawner.AddTask("bad", func(args map[string]interface{}) (interface{}, error) {
+			return nil, errors.New("bad shard")
+		}, 2)
+		bad.SetDependency(bad.NewDependencyExpr(spawner.AddTask("first", TaskDefault, 3).SetUndoFunc(undo, false)))
+		return nil, nil
+	}, nil).SetUndoFunc(undo, false)
+	controller.SetTermination(controller.NewTerminationExpr(parent))
+
+	_, err := controller.BatchRun()
+	aborted, ok := err.(ErrAborted)
+	if !ok {
+		t.Fatal(err)
+	}
+	if len(aborted.TaskErrors) != 1 || aborted.TaskErrors[0].TaskName != "bad" {
+		t.Fatal("TaskErrors Error", aborted.TaskErrors)
+	}
+	// parent, ok and first
+	if undone != 3 {
+		t.Fatal("Undo Error", undone)
+	}
+
+	// a child can only depend on its siblings
+	controller = NewTCController()
+	other := controller.AddTask("other", TaskDefault, 1)
+	invalid := controller.AddTask("invalid", func(args map[string]interface{}) (interface{}, error) {
+		child := args["SPAWN"].(*Spawner).AddTask("child", TaskDefault, 1)
+		child.SetDependency(child.NewDependencyExpr(other))
+		return nil, nil
+	}, nil)
+	controller.SetTermination(MakeAndExpr(controller.NewTerminationExpr(invalid), controller.NewTerminationExpr(other)))
+	_, err = controller.BatchRun()
+	if aborted, ok := err.(ErrAborted); !ok || len(aborted.TaskErrors) != 1 {
+		t.Fatal(err)
+	} else if _, ok := aborted.TaskErrors[0].Error.(ErrInvalidSpawn); !ok {
+		t.Fatal(err)
+	}
+	// the controller task is untouched
+	if len(other.subscribers) != 1 || other.subscribers[0] != controller.termination.id {
+		t.Fatal("Subscribers Error", other.subscribers)
+	}
+
+	// names of the children must be unique in the execution
+	for _, names := range [][]string{{"other"}, {"child", "child"}, {"BIND"}} {
+		names := names
+		invalid.SetTaskFunc(func(args map[string]interface{}) (interface{}, error) {
+			for _, name := range names {
+				args["SPAWN"].(*Spawner).AddTask(name, TaskDefault, 1)
+			}
+			return nil, nil
+		})
+		_, err = controller.BatchRun()
+		aborted, ok := err.(ErrAborted)
+		if !ok || len(aborted.TaskErrors) != 1 {
+			t.Fatal(names, err)
+		}
+		switch aborted.TaskErrors[0].Error.(type) {
+		case ErrDuplicateName, ErrReservedName:
+		default:
+			t.Fatal(names, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package gotcc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The key of args to keep the run of a sub controller until the rollback of its parent.
+const subRunKey = "SUBRUN"
+
+// Add a composite task, which runs the whole graph of controller `child` as one task. The
+// result of the task is a map[name]value of the termination results of the child, where the
+// names are namespaced as "name/task", and so are the task names in the errors of the child.
+// If the execution is aborted after the child succeeded, the child is rolled back before
+// the undo function of the composite task is called. The child runs without a coroutine pool.
+func (m *TCController) AddSubController(name string, child *TCController) *Executor {
+	e := m.AddTask(name, nil, nil)
+	e.sub = child
+	return e
+}
+
+// Get the task function of `e`. It runs the sub controller if `e` is a composite task.
+func (r *execution) taskFunc(e *Executor) func(args map[string]interface{}) (interface{}, error) {
+	if e.subPlan == nil {
+		return e.task
+	}
+	return func(args map[string]interface{}) (interface{}, error) {
+		return r.runSubController(e, args)
+	}
+}
+
+func (r *execution) runSubController(e *Executor, args map[string]interface{}) (interface{}, error) {
+	sub := e.subPlan.newExecution(args["CANCEL"].(context.Context), nil)
+	sub.namespace = r.name(e) + "/"
+	for _, report := range sub.reports {
+		report.TaskName = sub.namespace + report.TaskName
+	}
+
+	Results, err := sub.schedule(DefaultNoPool{})
+	if err != nil {
+		// the child has been rolled back
+		var aborted ErrAborted
+		if errors.As(err, &aborted) && aborted.Cause != nil {
+			return nil, ErrCancelled{State: subRunState{namespace: sub.namespace, aborted: aborted}}
+		}
+		return nil, err
+	}
+	args[subRunKey] = sub
+
+	res := make(map[string]interface{}, len(Results))
+	for name, value := range Results {
+		res[sub.namespace+name] = value
+	}
+	return res, nil
+}
+
+// The state of a child run cancelled by its parent.
+type subRunState struct {
+	namespace string
+	aborted   ErrAborted
+}
+
+func (s subRunState) String() string {
+	return fmt.Sprintf("sub controller %s cancelled, %d tasks cancelled, %d tasks failed to undo",
+		strings.TrimSuffix(s.namespace, "/"), len(s.aborted.Cancelled), len(s.aborted.UndoErrors))
+}
+
+// Roll back the child before calling `undo`.
+func subControllerUndo(undo func(args map[string]interface{}) error) func(args map[string]interface{}) error {
+	return func(args map[string]interface{}) error {
+		if sub, ok := args[subRunKey].(*execution); ok {
+			undoErrors := sub.undoStack.undoAll(&sub.errorMsgs, &sub.cancelled)
+			if len(undoErrors.items) > 0 {
+				return ErrAborted{UndoErrors: undoErrors.items}
+			}
+		}
+		return undo(args)
+	}
+}
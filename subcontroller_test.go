@@ -0,0 +1,114 @@
+package gotcc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSubController(t *testing.T) {
+	var lock sync.Mutex
+	undone := []string{}
+	record := func(args map[string]interface{}) error {
+		lock.Lock()
+		undone = append(undone, args["NAME"].(string))
+		lock.Unlock()
+		return nil
+	}
+
+	child := NewTCController()
+	A := child.AddTask("A", TaskDefault, 1).SetUndoFunc(record, false)
+	B := child.AddTask("B", TaskDefault, 2).SetUndoFunc(record, false)
+	B.SetDependency(B.NewDependencyExpr(A))
+	child.SetTermination(child.NewTerminationExpr(B))
+
+	controller := NewTCController()
+	reserve := controller.AddSubController("reserve", child).SetUndoFunc(record, false)
+	pay := controller.AddTask("pay", TaskDefault, 3)
+	pay.SetDependency(pay.NewDependencyExpr(reserve))
+	controller.SetTermination(MakeAndExpr(controller.NewTerminationExpr(reserve), controller.NewTerminationExpr(pay)))
+
+	res, err := controller.BatchRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2 + 1
+	if childRes, ok := res["reserve"].(map[string]interface{}); !ok || len(childRes) != 1 || childRes["reserve/B"] != 3 {
+		t.Fatal("Result Error", res)
+	}
+	if len(undone) != 0 {
+		t.Fatal("Undo Error", undone)
+	}
+
+	// the child is rolled back when the parent aborts
+	pay.task = func(args map[string]interface{}) (interface{}, error) {
+		return nil, errors.New("payment declined")
+	}
+	_, err = controller.BatchRun()
+	if _, ok := err.(ErrAborted); !ok {
+		t.Fatal(err)
+	}
+	if len(undone) != 3 || undone[0] != "B" || undone[1] != "A" || undone[2] != "reserve" {
+		t.Fatal("Undo Error", undone)
+	}
+
+	// the child fails
+	undone = undone[:0]
+	B.task = func(args map[string]interface{}) (interface{}, error) {
+		return nil, errors.New("out of stock")
+	}
+	_, err = controller.BatchRun()
+	aborted, ok := err.(ErrAborted)
+	if !ok || len(aborted.TaskErrors) != 1 || aborted.TaskErrors[0].TaskName != "reserve" {
+		t.Fatal(err)
+	}
+	childErr, ok := aborted.TaskErrors[0].Error.(ErrAborted)
+	if !ok || len(childErr.TaskErrors) != 1 || childErr.TaskErrors[0].TaskName != "reserve/B" {
+		t.Fatal(err)
+	}
+	// only A is rolled back, by the child itself
+	if len(undone) != 1 || undone[0] != "A" {
+		t.Fatal("Undo Error", undone)
+	}
+
+	// the parent aborts while the child is running
+	undone = undone[:0]
+	B.task = func(args map[string]interface{}) (interface{}, error) {
+		<-args["CANCEL"].(context.Context).Done()
+		return nil, ErrCancelled{}
+	}
+	pay.task = func(args map[string]interface{}) (interface{}, error) {
+		// let A of the child finish first
+		time.Sleep(20 * time.Millisecond)
+		return nil, errors.New("payment declined")
+	}
+	pay.SetDependency(DefaultTrueExpr)
+	_, err = controller.BatchRun()
+	aborted, ok = err.(ErrAborted)
+	if !ok || len(aborted.TaskErrors) != 1 || aborted.TaskErrors[0].TaskName != "pay" {
+		t.Fatal(err)
+	}
+	if len(aborted.Cancelled) != 1 || aborted.Cancelled[0].TaskName != "reserve" || aborted.Cancelled[0].State == nil {
+		t.Fatal("Cancelled Error", aborted.Cancelled)
+	}
+	if !strings.Contains(err.Error(), "sub controller reserve cancelled") {
+		t.Fatal(err)
+	}
+	// only A is rolled back, by the child itself
+	if len(undone) != 1 || undone[0] != "A" {
+		t.Fatal("Undo Error", undone)
+	}
+	pay.SetDependency(pay.NewDependencyExpr(reserve))
+
+	// the child can not be compiled
+	broken := controller.AddSubController("broken", NewTCController())
+	controller.SetTermination(MakeAndExpr(controller.NewTerminationExpr(pay), controller.NewTerminationExpr(broken)))
+	_, err = controller.BatchRun()
+	var subErr ErrSubController
+	if !errors.As(err, &subErr) || subErr.TaskName != "broken" || !errors.As(err, &ErrNoTermination{}) {
+		t.Fatal(err)
+	}
+}
@@ -5,34 +5,20 @@ import (
 	"fmt"
 	"sort"
 	"strings"
-	"sync"
 )
 
 // Task Concurrency Controller
 type TCController struct {
 	executors map[uint32]*Executor
 
-	cancelCtx  context.Context
-	cancelFunc context.CancelFunc
-
 	termination *Executor
-
-	cancelled cancelList
-	errorMsgs errorLisk
-	undoStack undoStack
 }
 
 // Create an empty task concurrency controller
 func NewTCController() *TCController {
-	ctx, cf := context.WithCancel(context.Background())
 	return &TCController{
 		executors:   map[uint32]*Executor{},
-		cancelCtx:   ctx,
-		cancelFunc:  cf,
 		termination: newExecutor("TERMINATION", nil, nil),
-		cancelled:   cancelList{},
-		errorMsgs:   errorLisk{},
-		undoStack:   undoStack{},
 	}
 }
 
@@ -45,6 +31,66 @@ func (m *TCController) AddTask(name string, f func(args map[string]interface{})
 	return e
 }
 
+// Get the task named `name`, or nil if there is no such task. If several tasks have
+// the same name, any of them is returned.
+func (m *TCController) Task(name string) *Executor {
+	for _, e := range m.executors {
+		if e.name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// Remove the task named `name` from the controller. If other tasks or the termination
+// expression still reference it, return ErrTaskInUse. If there is no such task, return
+// ErrTaskNotFound.
+func (m *TCController) RemoveTask(name string) error {
+	e := m.Task(name)
+	if e == nil {
+		return ErrTaskNotFound{TaskName: name}
+	}
+
+	users := []string{}
+	for _, subid := range e.subscribers {
+		if sub := m.executor(subid); sub != nil && sub.references(e) {
+			users = append(users, sub.name)
+		}
+	}
+	if len(users) > 0 {
+		sort.Strings(users)
+		return ErrTaskInUse{TaskName: name, UsedBy: users}
+	}
+
+	// the subscribers don't reference it anymore
+	for _, subid := range append([]uint32{}, e.subscribers...) {
+		if sub := m.executor(subid); sub != nil {
+			sub.unsubscribe(e)
+		}
+	}
+	for depid := range e.dependency {
+		if dep := m.executor(depid); dep != nil {
+			e.unsubscribe(dep)
+		}
+	}
+	delete(m.executors, e.id)
+	return nil
+}
+
+// Remove the termination dependency on task `d`. If the termination expression still
+// references `d`, return ErrTaskInUse.
+func (m *TCController) UnsubscribeTermination(d *Executor) error {
+	return m.termination.Unsubscribe(d)
+}
+
+// Get a task or the termination executor by id.
+func (m *TCController) executor(id uint32) *Executor {
+	if id == m.termination.id {
+		return m.termination
+	}
+	return m.executors[id]
+}
+
 // Set termination condition for the controller. `Expr` is a dependency expression.
 func (m *TCController) SetTermination(Expr DependencyExpression) {
 	m.termination.SetDependency(Expr)
@@ -58,135 +104,31 @@ func (m *TCController) TerminationExpr() DependencyExpression {
 // Create a termination dependency expression for the controller.
 // It means the execution termination may depend on task `d`.
 func (m *TCController) NewTerminationExpr(d *Executor) DependencyExpression {
-	if _, exists := m.termination.dependency[d.id]; !exists {
-		m.termination.dependency[d.id] = false
-		m.termination.messageBuffer = make(chan message, cap(m.termination.messageBuffer)+1)
-		d.subscribers = append(d.subscribers, &m.termination.messageBuffer)
-	}
-	return newDependencyExpr(m.termination.dependency, d.id)
+	return m.termination.NewDependencyExpr(d)
 }
 
 // Run the execution. If success, return a map[name]value, where names are task
 // of termination dependent tasks and values are their return value.
-// If failed, return ErrNoTermination, ErrLoopDependency or ErrAborted
+// If failed, return the first problem found by Validate, or ErrAborted
 func (m *TCController) BatchRun() (map[string]interface{}, error) {
-	if len(m.termination.dependency) == 0 {
-		return nil, ErrNoTermination{}
-	}
-	if _, noloop := m.analyzeDependency(); !noloop {
-		return nil, ErrLoopDependency{}
-	}
-
-	defer m.reset()
-
-	wg := sync.WaitGroup{}
-	wg.Add(len(m.executors))
-	for taskid := range m.executors {
-		e := m.executors[taskid]
-		go m.launch(e, &wg)
-	}
-
-	// wait termination
-	t := m.termination
-	Results := map[string]interface{}{}
-	Aborted := false
-
-waitLoop:
-	for !t.dependencyExpr.f() {
-		select {
-		case <-m.cancelCtx.Done():
-			// aborted
-			Aborted = true
-			break waitLoop
-		case msg := <-t.messageBuffer:
-			t.markDependency(msg.senderId, true)
-			Results[msg.senderName] = msg.value
-		}
-	}
-	if !Aborted {
-		// all done!
-		m.cancelFunc()
-		wg.Wait()
-		return Results, nil
-	} else {
-		// aborted because of some error
-		wg.Wait()
-		returnErr := ErrAborted{
-			TaskErrors: m.errorMsgs.items,
-			Cancelled:  m.cancelled.items,
-		}
-
-		// do the rollback
-		returnErr.UndoErrors = m.undoStack.undoAll(&m.errorMsgs, &m.cancelled).items
-		// fmt.Println(returnErr.Error())
-		return nil, returnErr
-	}
+	return m.BatchRunContext(context.Background())
 }
 
-func (m *TCController) launch(e *Executor, wg *sync.WaitGroup) {
-	defer wg.Done()
-	args := map[string]interface{}{"BIND": e.bindArgs, "CANCEL": m.cancelCtx, "NAME": e.name}
-
-	for !e.dependencyExpr.f() {
-		// wait until dep ok
-		select {
-		case <-m.cancelCtx.Done():
-			return
-		case msg := <-e.messageBuffer:
-			e.markDependency(msg.senderId, true)
-			args[msg.senderName] = msg.value
-		}
-	}
-
-	outMsg := message{senderId: e.id, senderName: e.name}
-	result, err := e.task(args)
+// Like BatchRun, but `ctx` becomes the parent of args["CANCEL"]. If `ctx` is
+// cancelled or its deadline is exceeded, the execution is aborted and rolled back,
+// and the returned ErrAborted records ctx.Err() as its Cause.
+func (m *TCController) BatchRunContext(ctx context.Context) (map[string]interface{}, error) {
+	plan, err := m.Compile()
 	if err != nil {
-		switch err := err.(type) {
-		case ErrSilentFail:
-			m.errorMsgs.append(newErrorMessage(e.name, err))
-		case ErrCancelled:
-			m.cancelled.append(newStateMessage(e.name, err.State))
-		default:
-			m.errorMsgs.append(newErrorMessage(e.name, err))
-			m.cancelFunc()
-		}
-		return
-	} else {
-		outMsg.value = result
-
-		// add to finished stack...
-		m.undoStack.push(newUndoFunc(e.name, e.undoSkipError, e.undo, args))
-	}
-
-	for _, subscriber := range e.subscribers {
-		*subscriber <- outMsg
-	}
-}
-
-func (m *TCController) reset() {
-	m.cancelCtx, m.cancelFunc = context.WithCancel(context.Background())
-	m.cancelled.reset()
-	m.errorMsgs.reset()
-	m.undoStack.reset()
-	for _, e := range m.executors {
-		e.messageBuffer = make(chan message, cap(e.messageBuffer))
-		for dep := range e.dependency {
-			e.dependency[dep] = false
-		}
-	}
-	for term := range m.termination.dependency {
-		m.termination.dependency[term] = false
+		return nil, err
 	}
+	return plan.BatchRunContext(ctx)
 }
 
 // The inner state of the controller
 func (m *TCController) String() string {
 	var sb strings.Builder
-	sb.WriteString("\ncanncelled list:\n")
-	sb.WriteString(m.cancelled.String())
-	sb.WriteString("errmessage list:\n")
-	sb.WriteString(m.errorMsgs.String())
-	sb.WriteString("tasks:\n")
+	sb.WriteString("\ntasks:\n")
 	ids := make([]uint32, 0, len(m.executors))
 	for id := range m.executors {
 		ids = append(ids, id)
@@ -195,7 +137,7 @@ func (m *TCController) String() string {
 	for _, id := range ids {
 		e := m.executors[id]
 		sb.WriteString(e.name)
-		sb.WriteString(fmt.Sprintf("[msgBuffer cap=%d]: (", cap(e.messageBuffer)))
+		sb.WriteString(fmt.Sprintf("[deps=%d]: (", len(e.dependency)))
 
 		depids := make([]uint32, 0, len(e.dependency))
 		for depid := range e.dependency {
@@ -208,11 +150,12 @@ func (m *TCController) String() string {
 		}
 		sb.WriteString(")\n")
 	}
-	sb.WriteString(fmt.Sprintf("@termination[msgBuffer cap=%d]: (", cap(m.termination.messageBuffer)))
+	sb.WriteString(fmt.Sprintf("@termination[deps=%d]: (", len(m.termination.dependency)))
 	termids := make([]uint32, 0, len(m.termination.dependency))
 	for termid := range m.termination.dependency {
 		termids = append(termids, termid)
 	}
+	sort.Slice(termids, func(i, j int) bool { return termids[i] < termids[j] })
 	for _, termid := range termids {
 		sb.WriteString(m.executors[termid].name)
 		sb.WriteString(", ")
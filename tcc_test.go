@@ -2,6 +2,8 @@ package gotcc
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 	"testing"
@@ -97,9 +99,13 @@ func TestLoopDependencyCond2(t *testing.T) {
 	controller.SetTermination(controller.NewTerminationExpr(C))
 
 	_, err := controller.BatchRun()
-	if _, ok := err.(ErrLoopDependency); !ok {
+	loop, ok := err.(ErrLoopDependency)
+	if !ok {
 		t.Fatal(err)
 	}
+	if fmt.Sprint(loop.Cycles) != "[[A B C]]" {
+		t.Fatal("Cycles Error", loop.Cycles)
+	}
 	t.Log(err.Error())
 }
 
@@ -149,13 +155,20 @@ func TestLoopDependencyCond4(t *testing.T) {
 	controller.SetTermination(controller.NewTerminationExpr(C))
 
 	_, err := controller.BatchRun()
-	if _, ok := err.(ErrLoopDependency); !ok {
+	loop, ok := err.(ErrLoopDependency)
+	if !ok {
 		t.Fatal(err)
 	}
+	if fmt.Sprint(loop.Cycles) != "[[A C B] [A C D]]" {
+		t.Fatal("Cycles Error", loop.Cycles)
+	}
+	if !strings.Contains(err.Error(), "A -> C -> B -> A") {
+		t.Fatal("Error Message Error", err)
+	}
 	t.Log(err.Error())
 }
 
-func TestPoolUnsupport(t *testing.T) {
+func TestPoolRunAnyExpr(t *testing.T) {
 	controller := NewTCController()
 	A := controller.AddTask("A", TaskDefault, 1)
 	B := controller.AddTask("B", TaskDefault, 2)
@@ -174,11 +187,13 @@ func TestPoolUnsupport(t *testing.T) {
 
 	pool := NewDefaultPool(2)
 	defer pool.Close()
-	_, err := controller.PoolRun(pool)
-	if _, ok := err.(ErrPoolUnsupport); !ok {
+	res, err := controller.PoolRun(pool)
+	if err != nil {
 		t.Fatal(err)
 	}
-	t.Log(err.Error())
+	if _, exists := res["F"]; !exists {
+		t.Fatal("Result Error", res)
+	}
 }
 
 func TestBatchRun(t *testing.T) {
@@ -265,7 +280,7 @@ func TestPoolRun(t *testing.T) {
 
 func TestPoolRunError(t *testing.T) {
 	controller := NewTCController()
-	A := controller.AddTask("A", TaskDefault, 1)
+	A := controller.AddTask("A", TaskHang, 10) // keep the only worker busy
 	B := controller.AddTask("B", TaskDefault, 2)
 	C := controller.AddTask("C", TaskDefault, 3)
 	D := controller.AddTask("D", TaskDefault, 4)
@@ -279,8 +294,8 @@ func TestPoolRunError(t *testing.T) {
 
 	controller.SetTermination(controller.NewTerminationExpr(F))
 
-	// should error!
-	pool, err := ants.NewPool(2, ants.WithNonblocking(true))
+	// should error! A and B are ready at the same time
+	pool, err := ants.NewPool(1, ants.WithNonblocking(true))
 	if err != nil {
 		panic(err)
 	}
@@ -307,7 +322,8 @@ func TestRunMultiple(t *testing.T) {
 	E.SetDependency(MakeAndExpr(E.NewDependencyExpr(B), E.NewDependencyExpr(C))) // 5 + 2 + 6 = 13
 	F.SetDependency(MakeAndExpr(F.NewDependencyExpr(D), F.NewDependencyExpr(E))) // 6 + 10 + 13 = 29
 
-	controller.SetTermination(controller.NewTerminationExpr(F))
+	// the termination depends on E too, so the order of its dependencies matters
+	controller.SetTermination(MakeAndExpr(controller.NewTerminationExpr(F), controller.NewTerminationExpr(E)))
 
 	innerState := controller.String()
 	for i := 0; i < 4; i++ {
@@ -677,3 +693,451 @@ func TestFailedWithSilentFail(t *testing.T) {
 		t.Log(err)
 	}
 }
+
+func TestRunWithContextDeadline(t *testing.T) {
+	controller := NewTCController()
+	A := controller.AddTask("A", TaskMayFailedOrCancelled, argsForTest{id: 1, sleepTime: 1}).SetUndoFunc(UndoMayFailed, false)
+	B := controller.AddTask("B", TaskMayFailedOrCancelled, argsForTest{id: 2, sleepTime: 100})
+	C := controller.AddTask("C", TaskDefault, 3)
+
+	C.SetDependency(MakeAndExpr(C.NewDependencyExpr(A), C.NewDependencyExpr(B)))
+	controller.SetTermination(controller.NewTerminationExpr(C))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := controller.BatchRunContext(ctx)
+	aborted, ok := err.(ErrAborted)
+	if !ok {
+		t.Fatal(err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("Cause Error", aborted.Cause)
+	}
+	if len(aborted.Cancelled) != 1 || aborted.Cancelled[0].TaskName != "B" {
+		t.Fatal("Cancelled Error", aborted.Cancelled)
+	}
+	t.Log(err)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	pool := NewDefaultPool(2)
+	defer pool.Close()
+	_, err = controller.PoolRunContext(ctx, pool)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+
+	// the controller is still usable after an aborted execution
+	res, err := controller.BatchRunContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := res["C"]; sum != 3 {
+		t.Fatal("Sum Error", sum)
+	}
+}
+
+func TaskHang(args map[string]interface{}) (interface{}, error) {
+	// ignore args["CANCEL"] on purpose
+	time.Sleep(time.Duration(args["BIND"].(int)) * time.Millisecond)
+	return "DONE", nil
+}
+
+func TestTaskTimeout(t *testing.T) {
+	controller := NewTCController()
+	A := controller.AddTask("A", TaskMayFailedOrCancelled, argsForTest{id: 1}).SetUndoFunc(UndoMayFailed, false)
+	B := controller.AddTask("B", TaskHang, 200).SetTimeout(20 * time.Millisecond)
+	C := controller.AddTask("C", TaskMayFailedOrCancelled, argsForTest{id: 3, sleepTime: 50}).SetTimeout(time.Second)
+	D := controller.AddTask("D", TaskDefault, 4)
+
+	D.SetDependency(MakeAndExpr(MakeAndExpr(D.NewDependencyExpr(A), D.NewDependencyExpr(B)), D.NewDependencyExpr(C)))
+	controller.SetTermination(controller.NewTerminationExpr(D))
+
+	start := time.Now()
+	_, err := controller.BatchRun()
+	if time.Since(start) > 100*time.Millisecond {
+		t.Fatal("hung task blocks the execution")
+	}
+	aborted, ok := err.(ErrAborted)
+	if !ok {
+		t.Fatal(err)
+	}
+	if len(aborted.TaskErrors) != 1 || aborted.TaskErrors[0].TaskName != "B" {
+		t.Fatal("TaskErrors Error", aborted.TaskErrors)
+	}
+	if _, ok := aborted.TaskErrors[0].Error.(ErrTaskTimeout); !ok {
+		t.Fatal("TaskErrors Error", aborted.TaskErrors[0].Error)
+	}
+	if len(aborted.Cancelled) != 1 || aborted.Cancelled[0].TaskName != "C" {
+		t.Fatal("Cancelled Error", aborted.Cancelled)
+	}
+	t.Log(err)
+
+	// tasks finished in time
+	B.SetTimeout(time.Second)
+	res, err := controller.BatchRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := res["D"]; sum != 4 {
+		t.Fatal("Sum Error", sum)
+	}
+}
+
+func TaskFailBeforeAttempt(args map[string]interface{}) (interface{}, error) {
+	attempt := args["ATTEMPT"].(int)
+	if attempt < args["BIND"].(int) {
+		return nil, ErrTaskFailed{attempt}
+	}
+	return attempt, nil
+}
+
+func TestTaskRetry(t *testing.T) {
+	controller := NewTCController()
+	A := controller.AddTask("A", TaskFailBeforeAttempt, 3).SetRetry(3, ConstantBackoff(time.Millisecond), nil)
+	B := controller.AddTask("B", TaskDefault, 2)
+	B.SetDependency(B.NewDependencyExpr(A))
+	controller.SetTermination(controller.NewTerminationExpr(B))
+
+	res, err := controller.BatchRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := res["B"]; sum != 5 {
+		t.Fatal("Sum Error", sum)
+	}
+
+	// attempts are used up
+	A.SetRetry(2, ExponentialBackoff(time.Millisecond, 10*time.Millisecond), nil)
+	_, err = controller.BatchRun()
+	aborted, ok := err.(ErrAborted)
+	if !ok {
+		t.Fatal(err)
+	}
+	if em := aborted.TaskErrors[0]; em.Attempts != 2 || len(em.AttemptErrors) != 2 {
+		t.Fatal("Attempts Error", em.Attempts, em.AttemptErrors)
+	}
+	t.Log(err)
+
+	// error is not retryable
+	A.SetRetry(3, JitterBackoff(time.Millisecond, 10*time.Millisecond), func(err error) bool {
+		return err.(ErrTaskFailed).id != 1
+	})
+	_, err = controller.BatchRun()
+	aborted, ok = err.(ErrAborted)
+	if !ok {
+		t.Fatal(err)
+	}
+	if em := aborted.TaskErrors[0]; em.Attempts != 1 {
+		t.Fatal("Attempts Error", em.Attempts, em.AttemptErrors)
+	}
+}
+
+func TestTaskRetryAfterTimeout(t *testing.T) {
+	done := make(chan struct{})
+	controller := NewTCController()
+	A := controller.AddTask("A", func(args map[string]interface{}) (interface{}, error) {
+		attempt := args["ATTEMPT"].(int)
+		if attempt == 1 {
+			// the timed out attempt keeps reading its args while the next attempt runs
+			defer close(done)
+			ctx := args["CANCEL"].(context.Context)
+			<-ctx.Done()
+			time.Sleep(20 * time.Millisecond)
+			return args["ATTEMPT"], nil
+		}
+		return attempt, nil
+	}, 0).SetTimeout(10*time.Millisecond).SetRetry(3, nil, nil)
+	B := controller.AddTask("B", TaskDefault, 2)
+	B.SetDependency(B.NewDependencyExpr(A))
+	controller.SetTermination(controller.NewTerminationExpr(B))
+
+	res, err := controller.BatchRun()
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := res["B"]; sum != 4 {
+		t.Fatal("Sum Error", sum)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	exponential := ExponentialBackoff(time.Millisecond, 5*time.Millisecond)
+	expected := []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 5 * time.Millisecond, 5 * time.Millisecond}
+	for i, d := range expected {
+		if exponential(i+1) != d {
+			t.Fatal("Backoff Error", i+1, exponential(i+1))
+		}
+	}
+	zero := ExponentialBackoff(0, time.Second)
+	for i := 1; i < 100; i++ {
+		if zero(i) != 0 {
+			t.Fatal("Backoff Error", i, zero(i))
+		}
+	}
+	huge := ExponentialBackoff(time.Duration(1)<<62, time.Duration(1<<63-1))
+	if d := huge(3); d != time.Duration(1<<63-1) {
+		t.Fatal("Backoff Error", d)
+	}
+	jitter := JitterBackoff(time.Millisecond, 5*time.Millisecond)
+	for i := 1; i < 100; i++ {
+		if d := jitter(i); d < 0 || d > 5*time.Millisecond {
+			t.Fatal("Backoff Error", i, d)
+		}
+	}
+}
+
+func TaskPanic(args map[string]interface{}) (interface{}, error) {
+	panic(args["BIND"])
+}
+
+func UndoPanic(args map[string]interface{}) error {
+	panic(args["BIND"])
+}
+
+func TestRecoverPanic(t *testing.T) {
+	controller := NewTCController()
+	A := controller.AddTask("A", TaskDefault, 1).SetUndoFunc(UndoPanic, true)
+	B := controller.AddTask("B", TaskDefault, 2).SetUndoFunc(UndoPanic, true)
+	C := controller.AddTask("C", TaskPanic, "boom").SetTimeout(time.Second)
+	D := controller.AddTask("D", TaskDefault, 4)
+
+	B.SetDependency(B.NewDependencyExpr(A))
+	C.SetDependency(C.NewDependencyExpr(B))
+	D.SetDependency(D.NewDependencyExpr(C))
+	controller.SetTermination(controller.NewTerminationExpr(D))
+
+	_, err := controller.BatchRun()
+	aborted, ok := err.(ErrAborted)
+	if !ok {
+		t.Fatal(err)
+	}
+	if len(aborted.TaskErrors) != 1 {
+		t.Fatal("TaskErrors Error", aborted.TaskErrors)
+	}
+	if taskPanic, ok := aborted.TaskErrors[0].Error.(ErrTaskPanic); !ok || taskPanic.Value != "boom" || len(taskPanic.Stack) == 0 {
+		t.Fatal("TaskErrors Error", aborted.TaskErrors[0].Error)
+	}
+	if len(aborted.UndoErrors) != 2 || aborted.UndoErrors[0].TaskName != "B" || aborted.UndoErrors[1].TaskName != "A" {
+		t.Fatal("UndoErrors Error", aborted.UndoErrors)
+	}
+	if _, ok := aborted.UndoErrors[0].Error.(ErrUndoPanic); !ok {
+		t.Fatal("UndoErrors Error", aborted.UndoErrors[0].Error)
+	}
+	t.Log(err)
+
+	// panic without timeout
+	C.SetTimeout(0)
+	pool := NewDefaultPool(2)
+	defer pool.Close()
+	_, err = controller.PoolRun(pool)
+	if _, ok := err.(ErrAborted); !ok {
+		t.Fatal(err)
+	}
+}
+
+func TestStalled(t *testing.T) {
+	controller := NewTCController()
+	undone := false
+	A := controller.AddTask("A", TaskDefault, 1).SetUndoFunc(func(args map[string]interface{}) error {
+		undone = true
+		return nil
+	}, false)
+	B := controller.AddTask("B", TaskSilentFail, nil)
+	C := controller.AddTask("C", TaskDefault, 3)
+	D := controller.AddTask("D", TaskDefault, 4)
+
+	C.SetDependency(MakeAndExpr(C.NewDependencyExpr(A), C.NewDependencyExpr(B)))
+	D.SetDependency(D.NewDependencyExpr(C))
+	controller.SetTermination(controller.NewTerminationExpr(D))
+
+	_, err := controller.BatchRun()
+	stalled, ok := err.(ErrStalled)
+	if !ok {
+		t.Fatal(err)
+	}
+	// C and D are skipped rather than pending
+	if len(stalled.Pending) != 0 {
+		t.Fatal("Pending Error", stalled.Pending)
+	}
+	if len(stalled.TaskErrors) != 1 || stalled.TaskErrors[0].TaskName != "B" {
+		t.Fatal("TaskErrors Error", stalled.TaskErrors)
+	}
+	if !undone {
+		t.Fatal("Undo Error")
+	}
+	t.Log(err)
+
+	pool := NewDefaultPool(2)
+	defer pool.Close()
+	if _, err = controller.PoolRun(pool); err == nil {
+		t.Fatal("Task not fail!")
+	} else if _, ok := err.(ErrStalled); !ok {
+		t.Fatal(err)
+	}
+
+	// termination is false after all tasks finished
+	C.SetDependency(C.NewDependencyExpr(A))
+	controller.SetTermination(MakeValueExpr(controller.termination, D, func(value interface{}) bool {
+		return value.(int) > 100
+	}))
+	if _, err = controller.BatchRun(); err == nil {
+		t.Fatal("Task not fail!")
+	} else if stalled, ok := err.(ErrStalled); !ok || len(stalled.Pending) != 0 {
+		t.Fatal(err)
+	}
+
+	// termination can never be true, since A succeeded before D
+	controller.SetTermination(MakeAndExpr(controller.NewTerminationExpr(D), MakeNotExpr(controller.NewTerminationExpr(A))))
+	if _, err = controller.BatchRun(); err == nil {
+		t.Fatal("Task not fail!")
+	} else if unsat, ok := err.(ErrUnsatisfiable); !ok || !unsat.Termination {
+		t.Fatal(err)
+	}
+}
+
+func TestTerminatedBySkip(t *testing.T) {
+	controller := NewTCController()
+	A := controller.AddTask("A", TaskSilentFail, nil)
+	B := controller.AddTask("B", TaskDefault, 2)
+	B.SetDependency(B.NewDependencyExpr(A))
+	controller.SetTermination(controller.termination.NewFinishedDependencyExpr(B))
+
+	// B is skipped, which finishes the termination
+	if _, err := controller.BatchRun(); err != nil {
+		t.Fatal(err)
+	}
+
+	controller = NewTCController()
+	P := controller.AddTask("P", TaskSilentFail, nil)
+	F := controller.AddTask("F", TaskDefault, 2)
+	F.SetDependency(F.NewDependencyExpr(P))
+	controller.SetTermination(MakeOrExpr(controller.NewTerminationExpr(P), MakeNotExpr(controller.NewTerminationExpr(F))))
+	if _, err := controller.BatchRun(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGraphEditing(t *testing.T) {
+	controller := NewTCController()
+	A := controller.AddTask("A", TaskDefault, 1)
+	B := controller.AddTask("B", TaskDefault, 2)
+	C := controller.AddTask("C", TaskDefault, 3)
+	D := controller.AddTask("D", TaskDefault, 4)
+
+	C.SetDependency(MakeAndExpr(C.NewDependencyExpr(A), C.NewDependencyExpr(B))) // 3 + 1 + 2 = 6
+	D.SetDependency(D.NewDependencyExpr(C))                                      // 4 + 6 = 10
+	controller.SetTermination(controller.NewTerminationExpr(D))
+
+	if controller.Task("C") != C || controller.Task("X") != nil {
+		t.Fatal("Task Error")
+	}
+	if _, ok := controller.RemoveTask("X").(ErrTaskNotFound); !ok {
+		t.Fatal("should error")
+	}
+	err := controller.RemoveTask("C")
+	if inUse, ok := err.(ErrTaskInUse); !ok || len(inUse.UsedBy) != 1 || inUse.UsedBy[0] != "D" {
+		t.Fatal(err)
+	}
+	if _, ok := controller.RemoveTask("D").(ErrTaskInUse); !ok {
+		t.Fatal("should error")
+	}
+	if _, ok := C.Unsubscribe(B).(ErrTaskInUse); !ok {
+		t.Fatal("should error")
+	}
+
+	// C doesn't depend on B anymore
+	C.SetDependency(C.NewDependencyExpr(A)) // 3 + 1 = 4
+	if err := C.Unsubscribe(B); err != nil {
+		t.Fatal(err)
+	}
+	if len(C.dependency) != 1 || len(B.subscribers) != 0 {
+		t.Fatal("Unsubscribe Error", C.dependency, B.subscribers)
+	}
+	if err := controller.RemoveTask("B"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := controller.BatchRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 4 + 4
+	if res["D"] != 8 {
+		t.Fatal("Result Error", res)
+	}
+
+	// replace D by E
+	E := controller.AddTask("E", TaskDefault, 5)
+	E.SetDependency(E.NewDependencyExpr(C))
+	controller.SetTermination(controller.NewTerminationExpr(E))
+	if err := controller.UnsubscribeTermination(D); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.RemoveTask("D"); err != nil {
+		t.Fatal(err)
+	}
+	if len(C.subscribers) != 1 || C.subscribers[0] != E.id || len(controller.termination.dependency) != 1 {
+		t.Fatal("Remove Error", C.subscribers, controller.termination.dependency)
+	}
+	E.SetTaskFunc(TaskHang).SetBindArgs(1)
+	res, err = controller.BatchRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res["E"] != "DONE" {
+		t.Fatal("Result Error", res)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	other := NewTCController()
+	X := other.AddTask("X", TaskDefault, 0)
+
+	controller := NewTCController()
+	A := controller.AddTask("A", TaskDefault, 1)
+	controller.AddTask("A", TaskDefault, 2)
+	B := controller.AddTask("BIND", TaskDefault, 3)
+	C := controller.AddTask("C", TaskDefault, 4)
+	controller.AddTask("D", TaskDefault, 5)
+
+	C.SetDependency(MakeAndExpr(C.NewDependencyExpr(A), C.NewDependencyExpr(X)))
+	controller.SetTermination(MakeAndExpr(controller.NewTerminationExpr(B), controller.NewTerminationExpr(C)))
+
+	errs := controller.Validate()
+	if len(errs) != 3 {
+		t.Fatal("Validate Error", errs)
+	}
+	if foreign, ok := errs[0].(ErrForeignExecutor); !ok || foreign.TaskName != "C" || foreign.Dependency != "X" {
+		t.Fatal(errs[0])
+	}
+	if duplicate, ok := errs[1].(ErrDuplicateName); !ok || duplicate.TaskName != "A" || duplicate.Count != 2 {
+		t.Fatal(errs[1])
+	}
+	if _, ok := errs[2].(ErrReservedName); !ok {
+		t.Fatal(errs[2])
+	}
+	// nothing is launched
+	if _, err := controller.BatchRun(); err != errs[0] {
+		t.Fatal(err)
+	}
+
+	C.SetDependency(C.NewDependencyExpr(A))
+	if err := C.Unsubscribe(X); err != nil {
+		t.Fatal(err)
+	}
+	errs = controller.Validate()
+	if len(errs) != 4 {
+		t.Fatal("Validate Error", errs)
+	}
+	// one of A and D can't reach the termination
+	if unreachable, ok := errs[2].(ErrUnreachable); !ok || (unreachable.TaskName != "A" && unreachable.TaskName != "D") {
+		t.Fatal(errs[2])
+	}
+	if unreachable, ok := errs[3].(ErrUnreachable); !ok || unreachable.TaskName != "D" {
+		t.Fatal(errs[3])
+	}
+	for _, err := range errs {
+		t.Log(err)
+	}
+}
@@ -0,0 +1,87 @@
+package gotcc
+
+import (
+	"context"
+	"reflect"
+)
+
+// A task executor with typed input and result. `In` is the result type of its typed
+// upstream tasks, and `Out` is the result type of itself. All methods of Executor
+// are available.
+type TypedExecutor[In, Out any] struct {
+	*Executor
+	inputs []string
+}
+
+// Arguments of a typed task function.
+type TypedArgs[In any] struct {
+	// name of the task
+	Name string
+	// the same as args["CANCEL"]
+	Cancel context.Context
+	// results of the typed upstream tasks, keyed by their names
+	Inputs map[string]In
+	// the untyped arguments, the same as the ones of an untyped task function
+	Args map[string]interface{}
+}
+
+// Add a typed task to the controller. `name` is a user-defined string identifier of the task.
+// `f` is the task function, which gets results of upstream tasks added by
+// NewTypedDependencyExpr from args.Inputs. If any of them is not of type `In`, for example
+// because the task function of an upstream task has been replaced, the task fails with
+// ErrInputType.
+func AddTypedTask[In, Out any](m *TCController, name string, f func(args TypedArgs[In]) (Out, error)) *TypedExecutor[In, Out] {
+	t := &TypedExecutor[In, Out]{}
+	t.Executor = m.AddTask(name, func(args map[string]interface{}) (interface{}, error) {
+		typedArgs := TypedArgs[In]{
+			Name:   args["NAME"].(string),
+			Cancel: args["CANCEL"].(context.Context),
+			Inputs: make(map[string]In, len(t.inputs)),
+			Args:   args,
+		}
+		for _, input := range t.inputs {
+			value, exists := args[input]
+			if !exists || value == nil {
+				continue
+			}
+			typed, ok := value.(In)
+			if !ok {
+				return nil, ErrInputType{
+					TaskName: typedArgs.Name,
+					Input:    input,
+					Expected: reflect.TypeOf((*In)(nil)).Elem().String(),
+					Actual:   reflect.TypeOf(value).String(),
+				}
+			}
+			typedArgs.Inputs[input] = typed
+		}
+		out, err := f(typedArgs)
+		if err != nil {
+			return nil, err
+		}
+		return out, nil
+	}, nil)
+	return t
+}
+
+// Create a dependency expression for the typed executor `e`. It means the task launching may
+// depend on the typed executor `d`, and the result of `d` will be in args.Inputs of `e`.
+// The result type of `d` must be the input type of `e`.
+func NewTypedDependencyExpr[In, Out, DIn any](e *TypedExecutor[In, Out], d *TypedExecutor[DIn, In]) DependencyExpression {
+	if _, exists := e.dependency[d.id]; !exists {
+		e.inputs = append(e.inputs, d.name)
+	}
+	return e.NewDependencyExpr(d.Executor)
+}
+
+// Get the result of the typed executor `e` from the results of BatchRun or PoolRun.
+// It returns false if the result doesn't exist or is not of type `Out`.
+func TypedResult[In, Out any](results map[string]interface{}, e *TypedExecutor[In, Out]) (Out, bool) {
+	value, exists := results[e.name]
+	if !exists {
+		var zero Out
+		return zero, false
+	}
+	out, ok := value.(Out)
+	return out, ok
+}
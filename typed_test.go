@@ -0,0 +1,59 @@
+package gotcc
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTypedTask(t *testing.T) {
+	controller := NewTCController()
+	A := AddTypedTask(controller, "A", func(args TypedArgs[struct{}]) (int, error) {
+		return 1, nil
+	})
+	B := AddTypedTask(controller, "B", func(args TypedArgs[struct{}]) (int, error) {
+		return 2, nil
+	})
+	C := AddTypedTask(controller, "C", func(args TypedArgs[int]) (string, error) {
+		return strconv.Itoa(args.Inputs["A"] + args.Inputs["B"]), nil
+	})
+	D := AddTypedTask(controller, "D", func(args TypedArgs[string]) ([]string, error) {
+		return []string{args.Name, args.Inputs["C"]}, nil
+	})
+
+	C.SetDependency(MakeAndExpr(NewTypedDependencyExpr(C, A), NewTypedDependencyExpr(C, B)))
+	D.SetDependency(NewTypedDependencyExpr(D, C))
+	controller.SetTermination(MakeAndExpr(controller.NewTerminationExpr(C.Executor), controller.NewTerminationExpr(D.Executor)))
+
+	res, err := controller.BatchRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := TypedResult(res, C); !ok || c != "3" {
+		t.Fatal("Result Error", c)
+	}
+	if d, ok := TypedResult(res, D); !ok || strings.Join(d, ",") != "D,3" {
+		t.Fatal("Result Error", d)
+	}
+	if _, ok := TypedResult(res, A); ok {
+		t.Fatal("Result Error")
+	}
+	res["C"] = 3
+	if _, ok := TypedResult(res, C); ok {
+		t.Fatal("Result Error")
+	}
+
+	// the result of A is not an int anymore
+	A.SetTaskFunc(func(args map[string]interface{}) (interface{}, error) {
+		return "1", nil
+	})
+	_, err = controller.BatchRun()
+	aborted, ok := err.(ErrAborted)
+	if !ok {
+		t.Fatal(err)
+	}
+	if inputErr, ok := aborted.TaskErrors[0].Error.(ErrInputType); !ok || inputErr.TaskName != "C" || inputErr.Input != "A" || inputErr.Expected != "int" || inputErr.Actual != "string" {
+		t.Fatal("TaskErrors Error", aborted.TaskErrors)
+	}
+	t.Log(err)
+}
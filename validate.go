@@ -0,0 +1,140 @@
+package gotcc
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Names which collide with the built-in keys of args.
+var reservedNames = map[string]bool{
+	"BIND":      true,
+	"CANCEL":    true,
+	"NAME":      true,
+	"TASKERR":   true,
+	"UNDOERR":   true,
+	"CANCELLED": true,
+	"ATTEMPT":   true,
+	"SPAWN":     true,
+	subRunKey:   true,
+}
+
+// Check the task graph and return every problem found, or nil if there is none.
+// The problems are, in this order: ErrNoTermination, ErrLoopDependency, ErrForeignExecutor,
+// ErrDuplicateName, ErrReservedName, ErrUnreachable, ErrUnsatisfiable and ErrSubController.
+// Compile, BatchRun and PoolRun return the first problem before launching anything.
+func (m *TCController) Validate() []error {
+	errs := []error{}
+	if len(m.termination.dependency) == 0 {
+		errs = append(errs, ErrNoTermination{})
+	}
+
+	executors := m.sortedExecutors()
+	foreign := []error{}
+	for _, e := range append(executors, m.termination) {
+		for _, name := range m.foreignDependencies(e) {
+			foreign = append(foreign, ErrForeignExecutor{TaskName: e.name, Dependency: name})
+		}
+	}
+	// analyzeDependency can't handle executors out of the controller
+	var sortedId []uint32
+	if len(foreign) == 0 {
+		taskorder, noloop := m.analyzeDependency()
+		if noloop {
+			sortedId = m.sortExecutor(taskorder)
+		} else {
+			errs = append(errs, ErrLoopDependency{Cycles: m.findCycles()})
+		}
+	}
+	errs = append(errs, foreign...)
+
+	count := map[string]int{}
+	for _, e := range executors {
+		count[e.name]++
+	}
+	for i, e := range executors {
+		if count[e.name] > 1 && (i == 0 || executors[i-1].name != e.name) {
+			errs = append(errs, ErrDuplicateName{TaskName: e.name, Count: count[e.name]})
+		}
+	}
+	for i, e := range executors {
+		if reservedNames[e.name] && (i == 0 || executors[i-1].name != e.name) {
+			errs = append(errs, ErrReservedName{TaskName: e.name})
+		}
+	}
+
+	if len(foreign) == 0 {
+		// the tasks which the termination depends on, directly or indirectly
+		reachable := map[uint32]bool{}
+		var visit func(e *Executor)
+		visit = func(e *Executor) {
+			for depid := range e.dependency {
+				if !reachable[depid] {
+					reachable[depid] = true
+					visit(m.executors[depid])
+				}
+			}
+		}
+		visit(m.termination)
+		for _, e := range executors {
+			if !reachable[e.id] {
+				errs = append(errs, ErrUnreachable{TaskName: e.name})
+			}
+		}
+	}
+
+	if sortedId != nil && len(m.termination.dependency) > 0 {
+		if err := m.checkSatisfiable(sortedId); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, e := range executors {
+		if e.sub == nil {
+			continue
+		}
+		if subErrs := e.sub.Validate(); len(subErrs) > 0 {
+			errs = append(errs, ErrSubController{TaskName: e.name, Err: subErrs[0]})
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Get the tasks of the controller, sorted by name.
+func (m *TCController) sortedExecutors() []*Executor {
+	executors := make([]*Executor, 0, len(m.executors))
+	for _, e := range m.executors {
+		executors = append(executors, e)
+	}
+	sort.Slice(executors, func(i, j int) bool {
+		if executors[i].name == executors[j].name {
+			return executors[i].id < executors[j].id
+		}
+		return executors[i].name < executors[j].name
+	})
+	return executors
+}
+
+// Get the names of the executors which `e` depends on, but don't belong to the controller.
+func (m *TCController) foreignDependencies(e *Executor) []string {
+	names := map[uint32]string{}
+	for _, d := range e.dependencyExpr.Executors() {
+		names[d.id] = d.name
+	}
+	res := []string{}
+	for depid := range e.dependency {
+		if _, exists := m.executors[depid]; exists {
+			continue
+		}
+		if name, exists := names[depid]; exists {
+			res = append(res, name)
+		} else {
+			res = append(res, fmt.Sprintf("#%d", depid))
+		}
+	}
+	sort.Strings(res)
+	return res
+}
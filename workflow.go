@@ -0,0 +1,131 @@
+package gotcc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Registry of named task functions and undo functions, used by LoadWorkflow and LoadWorkflowYAML.
+type Registry struct {
+	tasks map[string]func(args map[string]interface{}) (interface{}, error)
+	undos map[string]func(args map[string]interface{}) error
+}
+
+// Create an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		tasks: map[string]func(args map[string]interface{}) (interface{}, error){},
+		undos: map[string]func(args map[string]interface{}) error{},
+	}
+}
+
+// Register a task function with `name`.
+func (reg *Registry) RegisterTask(name string, f func(args map[string]interface{}) (interface{}, error)) *Registry {
+	reg.tasks[name] = f
+	return reg
+}
+
+// Register an undo function with `name`.
+func (reg *Registry) RegisterUndo(name string, undo func(args map[string]interface{}) error) *Registry {
+	reg.undos[name] = undo
+	return reg
+}
+
+// A declarative workflow. Dependency and Termination are expressions in text, see
+// ParseTerminationExpr for the syntax.
+type WorkflowDefinition struct {
+	Tasks       []TaskDefinition `json:"tasks" yaml:"tasks"`
+	Termination string           `json:"termination" yaml:"termination"`
+}
+
+// A task of a declarative workflow. Func and Undo are names in the registry. Args is
+// bind with the task as args["BIND"]. Timeout is a duration such as "1.5s", optional.
+type TaskDefinition struct {
+	Name          string      `json:"name" yaml:"name"`
+	Func          string      `json:"func" yaml:"func"`
+	Args          interface{} `json:"args,omitempty" yaml:"args,omitempty"`
+	Undo          string      `json:"undo,omitempty" yaml:"undo,omitempty"`
+	UndoSkipError bool        `json:"undoSkipError,omitempty" yaml:"undoSkipError,omitempty"`
+	Dependency    string      `json:"dependency,omitempty" yaml:"dependency,omitempty"`
+	Timeout       string      `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// Read a workflow definition in JSON from `r`, and build a controller with the functions
+// in `registry`. If failed, return ErrWorkflow.
+func LoadWorkflow(r io.Reader, registry *Registry) (*TCController, error) {
+	def := &WorkflowDefinition{}
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(def); err != nil {
+		return nil, ErrWorkflow{Err: err}
+	}
+	return BuildWorkflow(def, registry)
+}
+
+// Read a workflow definition in YAML from `r`, and build a controller with the functions
+// in `registry`. If failed, return ErrWorkflow.
+func LoadWorkflowYAML(r io.Reader, registry *Registry) (*TCController, error) {
+	def := &WorkflowDefinition{}
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(def); err != nil {
+		return nil, ErrWorkflow{Err: err}
+	}
+	return BuildWorkflow(def, registry)
+}
+
+// Build a controller from a workflow definition with the functions in `registry`.
+// If failed, return ErrWorkflow.
+func BuildWorkflow(def *WorkflowDefinition, registry *Registry) (*TCController, error) {
+	m := NewTCController()
+	executors := make(map[string]*Executor, len(def.Tasks))
+	for _, td := range def.Tasks {
+		if td.Name == "" {
+			return nil, ErrWorkflow{Err: fmt.Errorf("task without name")}
+		}
+		if _, exists := executors[td.Name]; exists {
+			return nil, ErrWorkflow{TaskName: td.Name, Err: fmt.Errorf("duplicate task name")}
+		}
+		f, exists := registry.tasks[td.Func]
+		if !exists {
+			return nil, ErrWorkflow{TaskName: td.Name, Err: fmt.Errorf("task function %q is not registered", td.Func)}
+		}
+		e := m.AddTask(td.Name, f, td.Args)
+		if td.Undo != "" {
+			undo, exists := registry.undos[td.Undo]
+			if !exists {
+				return nil, ErrWorkflow{TaskName: td.Name, Err: fmt.Errorf("undo function %q is not registered", td.Undo)}
+			}
+			e.SetUndoFunc(undo, td.UndoSkipError)
+		}
+		if td.Timeout != "" {
+			timeout, err := time.ParseDuration(td.Timeout)
+			if err != nil {
+				return nil, ErrWorkflow{TaskName: td.Name, Err: err}
+			}
+			e.SetTimeout(timeout)
+		}
+		executors[td.Name] = e
+	}
+
+	// all tasks have been added, so dependencies can refer to any of them
+	for _, td := range def.Tasks {
+		if td.Dependency == "" {
+			continue
+		}
+		if err := m.SetDependencyString(executors[td.Name], td.Dependency); err != nil {
+			return nil, ErrWorkflow{TaskName: td.Name, Err: err}
+		}
+	}
+	if def.Termination == "" {
+		return nil, ErrWorkflow{Err: ErrNoTermination{}}
+	}
+	if err := m.SetTerminationString(def.Termination); err != nil {
+		return nil, ErrWorkflow{Err: err}
+	}
+	return m, nil
+}
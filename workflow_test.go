@@ -0,0 +1,133 @@
+package gotcc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TaskSumFloat(args map[string]interface{}) (interface{}, error) {
+	sum := 0.0
+	for _, v := range args {
+		if num, ok := v.(float64); ok {
+			sum += num
+		}
+	}
+	return sum, nil
+}
+
+const testWorkflow = `{
+	"tasks": [
+		{"name": "C", "func": "sum", "args": 3, "dependency": "A && (B || failed(B))"},
+		{"name": "A", "func": "sum", "args": 1, "undo": "record", "undoSkipError": true},
+		{"name": "B", "func": "sum", "args": 2, "timeout": "1s"}
+	],
+	"termination": "C"
+}`
+
+func TestLoadWorkflow(t *testing.T) {
+	undone := false
+	registry := NewRegistry().RegisterTask("sum", TaskSumFloat).RegisterUndo("record", func(args map[string]interface{}) error {
+		undone = true
+		return nil
+	})
+
+	controller, err := LoadWorkflow(strings.NewReader(testWorkflow), registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := controller.BatchRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3 + 1 + 2
+	if res["C"] != 6.0 {
+		t.Fatal("Result Error", res)
+	}
+	if undone {
+		t.Fatal("Undo Error")
+	}
+	if s := controller.TerminationExpr().String(); s != "C" {
+		t.Fatal("Termination Error", s)
+	}
+
+	wrong := map[string]string{
+		`{"tasks": [{"name": "A", "func": "nothing"}], "termination": "A"}`:                           "A",
+		`{"tasks": [{"name": "A", "func": "sum", "undo": "nothing"}], "termination": "A"}`:            "A",
+		`{"tasks": [{"name": "A", "func": "sum"}, {"name": "A", "func": "sum"}], "termination": "A"}`: "A",
+		`{"tasks": [{"name": "A", "func": "sum", "timeout": "1 day"}], "termination": "A"}`:           "A",
+		`{"tasks": [{"name": "A", "func": "sum", "dependency": "B"}], "termination": "A"}`:            "A",
+		`{"tasks": [{"name": "A", "func": "sum"}], "termination": "A &&"}`:                            "",
+		`{"tasks": [{"name": "A", "func": "sum"}]}`:                                                   "",
+		`{"tasks": [{"name": "A", "func": "sum", "retry": 3}], "termination": "A"}`:                   "",
+		`{"tasks": [{"func": "sum"}], "termination": "A"}`:                                            "",
+	}
+	for doc, taskName := range wrong {
+		_, err := LoadWorkflow(strings.NewReader(doc), registry)
+		werr, ok := err.(ErrWorkflow)
+		if !ok || werr.TaskName != taskName {
+			t.Fatal(doc, err)
+		}
+	}
+
+	_, err = LoadWorkflow(strings.NewReader(`{"tasks": [{"name": "A", "func": "sum", "dependency": "B"}], "termination": "A"}`), registry)
+	var syntaxErr ErrExprSyntax
+	if !errors.As(err, &syntaxErr) || syntaxErr.Pos != 0 {
+		t.Fatal(err)
+	}
+}
+
+const testWorkflowYAML = `
+tasks:
+  - name: C
+    func: sum
+    args: 3
+    dependency: A && (B || failed(B))
+  - name: A
+    func: sum
+    args: 1
+    undo: record
+    undoSkipError: true
+  - name: B
+    func: sum
+    args: 2
+    timeout: 1s
+termination: C
+`
+
+func TestLoadWorkflowYAML(t *testing.T) {
+	registry := NewRegistry().RegisterTask("sum", TaskDefault).RegisterUndo("record", func(args map[string]interface{}) error {
+		return nil
+	})
+
+	controller, err := LoadWorkflowYAML(strings.NewReader(testWorkflowYAML), registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := controller.BatchRun()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// YAML integers are int
+	if res["C"] != 6 {
+		t.Fatal("Result Error", res)
+	}
+
+	wrong := map[string]string{
+		"tasks:\n  - name: A\n    func: nothing\ntermination: A\n":           "A",
+		"tasks:\n  - name: A\n    func: sum\n    retry: 3\ntermination: A\n": "",
+		"tasks: [\n": "",
+	}
+	for doc, taskName := range wrong {
+		_, err := LoadWorkflowYAML(strings.NewReader(doc), registry)
+		werr, ok := err.(ErrWorkflow)
+		if !ok || werr.TaskName != taskName {
+			t.Fatal(doc, err)
+		}
+	}
+
+	// JSON is YAML too
+	if _, err = LoadWorkflowYAML(strings.NewReader(testWorkflow), registry); err != nil {
+		t.Fatal(err)
+	}
+}